@@ -0,0 +1,400 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/snobb/goresq/pkg/admin"
+	"github.com/snobb/goresq/pkg/db"
+	"github.com/snobb/goresq/pkg/job"
+	"github.com/snobb/goresq/pkg/queue"
+)
+
+// env is the environment the commands run in.
+type env struct {
+	cfg    *config
+	pool   db.Pooler
+	stdout io.Writer
+	stderr io.Writer
+}
+
+func (e *env) admin() *admin.Admin {
+	a := admin.New(e.pool)
+	a.Namespace = e.cfg.Namespace
+
+	return a
+}
+
+type command struct {
+	name string
+	args string
+	help string
+	run  func(ctx context.Context, e *env, args []string) error
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"enqueue", "<queue> <class> [json-arg...]", "enqueue a job, every argument is a JSON value", enqueue},
+		{"queues", "", "list the queues and their sizes", queues},
+		{"peek", "[-start n] [-count n] <queue>", "show the jobs in the queue", peek},
+		{"remove", "<queue> <class> [json-arg...]", "remove the jobs of the class, optionally with the arguments", remove},
+		{"remove-queue", "<queue>", "delete the queue with all its jobs", removeQueue},
+		{"workers", "", "list the workers", workers},
+		{"stats", "", "show the statistics", stats},
+		{"reset-stats", "", "reset the job counters", resetStats},
+		{"failed", "[-start n] [-count n]", "list the failed jobs", failed},
+		{"retry", "<index>...", "retry the failed jobs", retry},
+		{"clear-failed", "", "remove all the failed jobs", clearFailed},
+		{"prune", "[-age duration]", "unregister the workers without a recent heartbeat", prune},
+	}
+}
+
+func enqueue(ctx context.Context, e *env, args []string) error {
+	if len(args) < 2 {
+		return usage(e, "enqueue")
+	}
+
+	data, err := jsonArgs(args[2:])
+	if err != nil {
+		return err
+	}
+
+	q := queue.New(e.pool)
+	q.Namespace = e.cfg.Namespace
+
+	values := make([]interface{}, len(data))
+	for i, arg := range data {
+		values[i] = arg
+	}
+
+	res, err := q.Enqueue(ctx, args[0], args[1], values)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(e.stdout, "enqueued %s job %s to %s, queue length %d\n", args[1], res.ID, res.Queue, res.Length)
+
+	return nil
+}
+
+func queues(_ context.Context, e *env, args []string) error {
+	if len(args) != 0 {
+		return usage(e, "queues")
+	}
+
+	queues, err := e.admin().Queues()
+	if err != nil {
+		return err
+	}
+
+	tw := table(e.stdout, "QUEUE", "SIZE")
+	for _, q := range queues {
+		fmt.Fprintf(tw, "%s\t%d\n", q.Name, q.Size)
+	}
+
+	return tw.Flush()
+}
+
+func peek(_ context.Context, e *env, args []string) error {
+	fs, start, count := pageFlags(e, "peek")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 1 {
+		return usage(e, "peek")
+	}
+
+	jobs, err := e.admin().Peek(fs.Arg(0), *start, *count)
+	if err != nil {
+		return err
+	}
+
+	tw := table(e.stdout, "INDEX", "CLASS", "ARGS", "ENQUEUED AT")
+	for i, jb := range jobs {
+		args, err := json.Marshal(jb.Args)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", *start+i, jb.Class, args, enqueuedAt(jb.EnqueuedAt))
+	}
+
+	return tw.Flush()
+}
+
+func remove(ctx context.Context, e *env, args []string) error {
+	if len(args) < 2 {
+		return usage(e, "remove")
+	}
+
+	data, err := jsonArgs(args[2:])
+	if err != nil {
+		return err
+	}
+
+	n, err := e.admin().RemoveJobs(ctx, args[0], args[1], data...)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(e.stdout, "removed %d jobs\n", n)
+
+	return nil
+}
+
+func removeQueue(_ context.Context, e *env, args []string) error {
+	if len(args) != 1 {
+		return usage(e, "remove-queue")
+	}
+
+	if err := e.admin().RemoveQueue(args[0]); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(e.stdout, "removed queue %s\n", args[0])
+
+	return nil
+}
+
+func workers(_ context.Context, e *env, args []string) error {
+	if len(args) != 0 {
+		return usage(e, "workers")
+	}
+
+	workers, err := e.admin().Workers()
+	if err != nil {
+		return err
+	}
+
+	tw := table(e.stdout, "WORKER", "QUEUES", "STARTED AT", "HEARTBEAT", "JOB")
+	for _, w := range workers {
+		heartbeat, current := "-", "-"
+
+		if w.Heartbeat != nil {
+			heartbeat = time.Since(*w.Heartbeat).Round(time.Second).String() + " ago"
+		}
+
+		if w.Job != nil {
+			current = w.Job.Queue + "/" + w.Job.Payload.Class
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", w.ID, strings.Join(w.Queues, ","),
+			w.StartedAt.Format(time.RFC3339), heartbeat, current)
+	}
+
+	return tw.Flush()
+}
+
+func stats(_ context.Context, e *env, args []string) error {
+	if len(args) != 0 {
+		return usage(e, "stats")
+	}
+
+	stats, err := e.admin().Stats()
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(e.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "processed\t%d\n", stats.Processed)
+	fmt.Fprintf(tw, "failed\t%d\n", stats.Failed)
+	fmt.Fprintf(tw, "pending\t%d\n", stats.Pending)
+	fmt.Fprintf(tw, "queues\t%d\n", stats.Queues)
+	fmt.Fprintf(tw, "workers\t%d\n", stats.Workers)
+	fmt.Fprintf(tw, "working\t%d\n", stats.Working)
+
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	counts, err := e.admin().Statistics().Queues()
+	if err != nil {
+		return err
+	}
+
+	if len(counts) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	fmt.Fprintln(e.stdout)
+
+	tw = table(e.stdout, "QUEUE", "PROCESSED", "FAILED")
+	for _, name := range names {
+		fmt.Fprintf(tw, "%s\t%d\t%d\n", name, counts[name].Processed, counts[name].Failed)
+	}
+
+	return tw.Flush()
+}
+
+func resetStats(_ context.Context, e *env, args []string) error {
+	if len(args) != 0 {
+		return usage(e, "reset-stats")
+	}
+
+	if err := e.admin().Statistics().Reset(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(e.stdout, "reset stats")
+
+	return nil
+}
+
+func failed(_ context.Context, e *env, args []string) error {
+	fs, start, count := pageFlags(e, "failed")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 {
+		return usage(e, "failed")
+	}
+
+	failures := e.admin().Failures()
+
+	total, err := failures.Count()
+	if err != nil {
+		return err
+	}
+
+	items, err := failures.Range(*start, *count)
+	if err != nil {
+		return err
+	}
+
+	tw := table(e.stdout, "INDEX", "FAILED AT", "QUEUE", "CLASS", "ERROR", "RETRIED AT")
+	for i, f := range items {
+		retried := f.RetriedAt
+		if retried == "" {
+			retried = "-"
+		}
+
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\n", *start+i, f.FailedAt, f.Queue, f.Payload.Class, f.Error, retried)
+	}
+
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(e.stdout, "%d of %d failed jobs\n", len(items), total)
+
+	return nil
+}
+
+func retry(_ context.Context, e *env, args []string) error {
+	if len(args) == 0 {
+		return usage(e, "retry")
+	}
+
+	failures := e.admin().Failures()
+
+	for _, arg := range args {
+		index, err := strconv.Atoi(arg)
+		if err != nil || index < 0 {
+			return fmt.Errorf("invalid index %q", arg)
+		}
+
+		if err := failures.Retry(index); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(e.stdout, "retried %d\n", index)
+	}
+
+	return nil
+}
+
+func clearFailed(_ context.Context, e *env, args []string) error {
+	if len(args) != 0 {
+		return usage(e, "clear-failed")
+	}
+
+	if err := e.admin().Failures().Clear(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(e.stdout, "cleared failed jobs")
+
+	return nil
+}
+
+func prune(_ context.Context, e *env, args []string) error {
+	fs := flag.NewFlagSet("prune", flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	age := fs.Duration("age", 5*time.Minute, "prune the workers without a heartbeat for longer than the age")
+
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 {
+		return usage(e, "prune")
+	}
+
+	pruned, err := e.admin().PruneWorkers(*age)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range pruned {
+		fmt.Fprintf(e.stdout, "pruned %s\n", id)
+	}
+
+	fmt.Fprintf(e.stdout, "pruned %d workers\n", len(pruned))
+
+	return nil
+}
+
+func pageFlags(e *env, name string) (fs *flag.FlagSet, start, count *int) {
+	fs = flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	start = fs.Int("start", 0, "index of the first item")
+	count = fs.Int("count", 20, "number of the items")
+
+	return fs, start, count
+}
+
+func jsonArgs(args []string) ([]json.RawMessage, error) {
+	data := make([]json.RawMessage, len(args))
+
+	for i, arg := range args {
+		if !json.Valid([]byte(arg)) {
+			return nil, fmt.Errorf("argument %d is not valid JSON: %s", i+1, arg)
+		}
+
+		data[i] = json.RawMessage(arg)
+	}
+
+	return data, nil
+}
+
+func enqueuedAt(ts float64) string {
+	if ts == 0 {
+		return "-"
+	}
+
+	return job.Time(ts).UTC().Format(time.RFC3339)
+}
+
+func table(w io.Writer, headers ...string) *tabwriter.Writer {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(headers, "\t"))
+
+	return tw
+}
+
+func usage(e *env, name string) error {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			fmt.Fprintf(e.stderr, "Usage: goresq %s %s\n", cmd.name, cmd.args)
+		}
+	}
+
+	return errUsage
+}
@@ -0,0 +1,129 @@
+// Command goresq inspects and operates the Resque queues, workers and failed jobs.
+//
+// Usage:
+//
+//	goresq [flags] <command> [arguments]
+//
+// The redis connection and the namespace are configured with the flags or with the
+// GORESQ_REDIS, GORESQ_DB and GORESQ_NAMESPACE environment variables. The flags take
+// precedence over the environment. Run goresq -h for the list of the commands.
+//
+// The failed jobs are read from the <ns>:failed list of the default Redis failure backend; the
+// jobs saved to another backend, such as the per-queue lists, are not handled.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/snobb/goresq/pkg/db"
+)
+
+// config represents the global configuration of the tool.
+type config struct {
+	Redis     string
+	DB        int
+	Namespace string
+}
+
+// errUsage is returned when the command line is invalid. The usage has been printed already.
+var errUsage = errors.New("invalid usage")
+
+func main() {
+	newPool := func(cfg *config) db.Pooler {
+		return db.NewPool(&db.Config{URI: cfg.Redis, DB: cfg.DB})
+	}
+
+	if err := run(context.Background(), os.Args[1:], os.Getenv, os.Stdout, os.Stderr, newPool); err != nil {
+		if !errors.Is(err, errUsage) {
+			fmt.Fprintf(os.Stderr, "goresq: %s\n", err)
+		}
+
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, args []string, getenv func(string) string, stdout, stderr io.Writer,
+	newPool func(*config) db.Pooler,
+) error {
+	cfg, err := envConfig(getenv)
+	if err != nil {
+		return err
+	}
+
+	fs := flag.NewFlagSet("goresq", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.StringVar(&cfg.Redis, "redis", cfg.Redis, "redis address [$GORESQ_REDIS]")
+	fs.IntVar(&cfg.DB, "db", cfg.DB, "redis database [$GORESQ_DB]")
+	fs.StringVar(&cfg.Namespace, "namespace", cfg.Namespace, "resque namespace [$GORESQ_NAMESPACE]")
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: goresq [flags] <command> [arguments]\n\nCommands:\n")
+
+		for _, cmd := range commands {
+			fmt.Fprintf(stderr, "  %-40s %s\n", cmd.name+" "+cmd.args, cmd.help)
+		}
+
+		fmt.Fprintf(stderr, "\nFlags:\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+
+		return errUsage
+	}
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errUsage
+	}
+
+	for _, cmd := range commands {
+		if cmd.name != fs.Arg(0) {
+			continue
+		}
+
+		pool := newPool(cfg)
+		defer pool.Close()
+
+		return cmd.run(ctx, &env{cfg: cfg, pool: pool, stdout: stdout, stderr: stderr}, fs.Args()[1:])
+	}
+
+	fmt.Fprintf(stderr, "goresq: unknown command %q\n", fs.Arg(0))
+	fs.Usage()
+
+	return errUsage
+}
+
+func envConfig(getenv func(string) string) (*config, error) {
+	cfg := &config{
+		Redis:     "localhost:6379",
+		Namespace: "resque",
+	}
+
+	if value := getenv("GORESQ_REDIS"); value != "" {
+		cfg.Redis = value
+	}
+
+	if value := getenv("GORESQ_NAMESPACE"); value != "" {
+		cfg.Namespace = value
+	}
+
+	if value := getenv("GORESQ_DB"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid GORESQ_DB %q: %w", value, err)
+		}
+
+		cfg.DB = n
+	}
+
+	return cfg, nil
+}
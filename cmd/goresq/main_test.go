@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/snobb/goresq/pkg/db"
+
+	"github.com/snobb/goresq/test/assert"
+	"github.com/snobb/goresq/test/fakeredis"
+)
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name         string
+		args         []string
+		env          map[string]string
+		seed         [][]interface{}
+		wantErr      bool
+		wantStdout   string
+		wantStdoutRe string
+		wantLists    map[string]int
+	}{
+		{
+			name:         "enqueue",
+			args:         []string{"enqueue", "mail", "Mail", `{"to":"a@b.c"}`, "1"},
+			wantLists:    map[string]int{"resque:queue:mail": 1},
+			wantStdoutRe: `^enqueued Mail job [0-9a-f-]{36} to mail, queue length 1\n$`,
+		},
+		{
+			name:         "enqueue with the namespace from the environment",
+			args:         []string{"enqueue", "mail", "Mail"},
+			env:          map[string]string{"GORESQ_NAMESPACE": "custom"},
+			wantLists:    map[string]int{"custom:queue:mail": 1, "resque:queue:mail": 0},
+			wantStdoutRe: `^enqueued Mail job [0-9a-f-]{36} to mail, queue length 1\n$`,
+		},
+		{
+			name:    "enqueue invalid json",
+			args:    []string{"enqueue", "mail", "Mail", "{"},
+			wantErr: true,
+		},
+		{
+			name: "queues",
+			args: []string{"queues"},
+			seed: [][]interface{}{
+				{"SADD", "resque:queues", "mail"},
+				{"RPUSH", "resque:queue:mail", `{"class":"Mail","args":[]}`},
+			},
+			wantStdout: "QUEUE  SIZE\nmail   1\n",
+		},
+		{
+			name: "remove with arguments",
+			args: []string{"remove", "mail", "Mail", "1"},
+			seed: [][]interface{}{
+				{"RPUSH", "resque:queue:mail", `{"class":"Mail","args":[1]}`, `{"class":"Mail","args":[2]}`,
+					`{"class":"Mail","args":[ 1 ]}`},
+			},
+			wantStdout: "removed 2 jobs\n",
+			wantLists:  map[string]int{"resque:queue:mail": 1},
+		},
+		{
+			name: "remove queue",
+			args: []string{"remove-queue", "mail"},
+			seed: [][]interface{}{
+				{"SADD", "resque:queues", "mail"},
+				{"RPUSH", "resque:queue:mail", `{"class":"Mail","args":[]}`},
+			},
+			wantStdout: "removed queue mail\n",
+			wantLists:  map[string]int{"resque:queue:mail": 0},
+		},
+		{
+			name: "stats",
+			args: []string{"-namespace", "custom", "stats"},
+			seed: [][]interface{}{
+				{"SET", "custom:stat:processed", "3"},
+			},
+			wantStdout: "processed  3\nfailed     0\npending    0\nqueues     0\nworkers    0\nworking    0\n",
+		},
+		{
+			name:    "unknown command",
+			args:    []string{"bogus"},
+			wantErr: true,
+		},
+		{
+			name:    "no command",
+			wantErr: true,
+		},
+		{
+			name:    "invalid db",
+			args:    []string{"queues"},
+			env:     map[string]string{"GORESQ_DB": "x"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rds := fakeredis.New()
+			rds.Seed(t, tt.seed...)
+
+			var stdout, stderr bytes.Buffer
+
+			err := run(context.Background(), tt.args, func(key string) string { return tt.env[key] },
+				&stdout, &stderr, func(*config) db.Pooler { return rds.Pool() })
+
+			assert.Eq(t, tt.wantErr, err != nil)
+
+			if tt.wantStdout != "" {
+				assert.Eq(t, tt.wantStdout, stdout.String())
+			}
+
+			if tt.wantStdoutRe != "" {
+				assert.Eq(t, true, regexp.MustCompile(tt.wantStdoutRe).MatchString(stdout.String()))
+			}
+
+			for key, want := range tt.wantLists {
+				assert.Eq(t, want, len(rds.List(key)))
+			}
+
+			if tt.wantErr {
+				assert.Eq(t, true, strings.TrimSpace(stderr.String()) != "" || err != errUsage)
+			}
+		})
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"log/slog"
 	"os"
 	"os/signal"
 	"syscall"
@@ -12,6 +13,7 @@ import (
 
 	"github.com/snobb/goresq/pkg/db"
 	"github.com/snobb/goresq/pkg/job"
+	"github.com/snobb/goresq/pkg/logger"
 	"github.com/snobb/goresq/pkg/poller"
 	"github.com/snobb/goresq/pkg/queue"
 )
@@ -89,13 +91,12 @@ func main() {
 		},
 	}
 
-	p := poller.New(redis, time.Millisecond*100, 3)
-	errs := make(chan error)
-	go func() {
-		for err := range errs {
+	p := poller.New(redis, time.Millisecond*100, 3,
+		poller.WithLogger(logger.Slog(slog.Default())),
+		poller.WithErrorHandler(poller.ErrorHandlerFunc(func(err error) {
 			log.Printf("error: %s", err.Error())
-		}
-	}()
+		})),
+	)
 
 	go func() {
 		q := queue.New(redis)
@@ -106,8 +107,15 @@ func main() {
 			"task_data": []int{10, 20, 30},
 		}
 
-		_ = q.Enqueue(context.Background(), "queue2.test", "sum", []interface{}{payload})
-		_ = q.Enqueue(context.Background(), "queue1.test", "sum", []interface{}{payload})
+		for _, name := range []string{"queue2.test", "queue1.test"} {
+			res, err := q.Enqueue(context.Background(), name, "sum", []interface{}{payload})
+			if err != nil {
+				log.Printf("enqueue failed: %s", err.Error())
+				continue
+			}
+
+			log.Printf("enqueued job %s to %s (length %d)", res.ID, res.Queue, res.Length)
+		}
 	}()
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -119,7 +127,7 @@ func main() {
 		cancel()
 	}()
 
-	if err := p.Start(ctx, []string{"queue1.test", "queue2.test"}, handlers, errs); err != nil {
+	if err := p.Start(ctx, []string{"queue1.test", "queue2.test"}, handlers); err != nil {
 		panic(err)
 	}
 }
@@ -0,0 +1,153 @@
+package activejob
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/snobb/goresq/pkg/job"
+	"github.com/snobb/goresq/pkg/queue"
+)
+
+// WrapperClass is the class of the jobs enqueued by the ActiveJob Resque adapter.
+const WrapperClass = "ActiveJob::QueueAdapters::ResqueAdapter::JobWrapper"
+
+// ErrInvalidEnvelope is returned when the arguments of a wrapper job are not an ActiveJob job.
+var ErrInvalidEnvelope = errors.New("invalid activejob envelope")
+
+// Job is an ActiveJob job as serialized by ActiveJob::Core#serialize. It is the single argument
+// of the wrapper job.
+type Job struct {
+	JobClass            string            `json:"job_class"`
+	JobID               string            `json:"job_id"`
+	ProviderJobID       *string           `json:"provider_job_id"`
+	QueueName           string            `json:"queue_name"`
+	Priority            *int              `json:"priority"`
+	Arguments           []json.RawMessage `json:"arguments"`
+	Executions          int               `json:"executions"`
+	ExceptionExecutions map[string]int    `json:"exception_executions"`
+	Locale              string            `json:"locale"`
+	Timezone            string            `json:"timezone"`
+	EnqueuedAt          string            `json:"enqueued_at"`
+}
+
+// New creates a new ActiveJob job of the class to be performed by Rails with the arguments.
+// The arguments must be plain JSON values, the hashes must not use the reserved _aj_ keys.
+func New(queueName, class string, args ...interface{}) (*Job, error) {
+	arguments := make([]json.RawMessage, len(args))
+
+	for i, arg := range args {
+		buf, err := json.Marshal(arg)
+		if err != nil {
+			return nil, fmt.Errorf("marshal argument %d: %w", i, err)
+		}
+
+		arguments[i] = buf
+	}
+
+	return &Job{
+		JobClass:            class,
+		JobID:               job.NewID(),
+		QueueName:           queueName,
+		Arguments:           arguments,
+		ExceptionExecutions: map[string]int{},
+		Locale:              "en",
+		Timezone:            "UTC",
+		EnqueuedAt:          time.Now().UTC().Format("2006-01-02T15:04:05.000000000Z"),
+	}, nil
+}
+
+// Enqueue wraps the job in the envelope of the ActiveJob Resque adapter and enqueues it so that
+// it can be performed by Rails.
+func Enqueue(ctx context.Context, q *queue.Queue, queueName, class string, args ...interface{}) (queue.EnqueueResult, error) {
+	jb, err := New(queueName, class, args...)
+	if err != nil {
+		return queue.EnqueueResult{}, err
+	}
+
+	return q.Enqueue(ctx, queueName, WrapperClass, []interface{}{jb})
+}
+
+// Unwrap returns the job wrapped by the ActiveJob Resque adapter with the class set to the
+// ActiveJob job class, the arguments deserialized and the id set to the ActiveJob job id. The
+// other jobs are returned as is.
+func Unwrap(jb *job.Job) (*job.Job, error) {
+	if jb.Payload.Class != WrapperClass {
+		return jb, nil
+	}
+
+	if len(jb.Payload.Args) != 1 {
+		return nil, fmt.Errorf("%w: expected 1 argument, got %d", ErrInvalidEnvelope, len(jb.Payload.Args))
+	}
+
+	var aj Job
+	if err := json.Unmarshal(jb.Payload.Args[0], &aj); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidEnvelope, err)
+	}
+
+	if aj.JobClass == "" {
+		return nil, fmt.Errorf("%w: missing job_class", ErrInvalidEnvelope)
+	}
+
+	args := make([]json.RawMessage, len(aj.Arguments))
+
+	for i, arg := range aj.Arguments {
+		value, err := Deserialize(arg)
+		if err != nil {
+			return nil, fmt.Errorf("%w: argument %d: %w", ErrInvalidEnvelope, i, err)
+		}
+
+		args[i] = value
+	}
+
+	inner := *jb
+	inner.Payload.Class = aj.JobClass
+	inner.Payload.Args = args
+	inner.Payload.Attempt = max(jb.Payload.Attempt, aj.Executions+1)
+
+	if aj.JobID != "" {
+		inner.Payload.ID = aj.JobID
+	}
+
+	return &inner, nil
+}
+
+// Handlers returns the handlers with an additional handler for the ActiveJob wrapper class.
+// The wrapper jobs are unwrapped and performed by the handler of the ActiveJob job class
+// together with its plugins.
+func Handlers(handlers map[string]job.Handler) map[string]job.Handler {
+	res := make(map[string]job.Handler, len(handlers)+1)
+	for class, h := range handlers {
+		res[class] = h
+	}
+
+	res[WrapperClass] = &wrapper{handlers: handlers}
+
+	return res
+}
+
+type wrapper struct {
+	handlers map[string]job.Handler
+}
+
+// Plugins returns no plugins, the plugins of the unwrapped job handler are run instead.
+func (w *wrapper) Plugins() []job.Plugin {
+	return nil
+}
+
+// Perform unwraps the job and performs it with the handler of the ActiveJob job class.
+func (w *wrapper) Perform(ctx context.Context, queue, class string, args []json.RawMessage) (job.Result, error) {
+	jb := &job.Job{Queue: queue, Payload: job.Payload{Class: class, Args: args}}
+	if e, ok := job.FromContext(ctx); ok {
+		jb = &e.Job
+	}
+
+	inner, err := Unwrap(jb)
+	if err != nil {
+		return nil, err
+	}
+
+	return job.Run(ctx, w.handlers, inner)
+}
@@ -0,0 +1,228 @@
+package activejob_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/snobb/goresq/pkg/activejob"
+	"github.com/snobb/goresq/pkg/job"
+	"github.com/snobb/goresq/pkg/queue"
+
+	"github.com/snobb/goresq/test/assert"
+	"github.com/snobb/goresq/test/fakeredis"
+)
+
+// envelope is a payload enqueued by Rails 7 with the Resque adapter.
+const envelope = `{"class":"ActiveJob::QueueAdapters::ResqueAdapter::JobWrapper","args":[{` +
+	`"job_class":"SendInvoiceJob","job_id":"0b3c2f5e-4e1d-4d6e-9b1a-3c1f2e9d8a7b","provider_job_id":null,` +
+	`"queue_name":"mailers","priority":null,"arguments":[` +
+	`{"_aj_globalid":"gid://billing/Invoice/42"},` +
+	`{"force":true,"channel":{"_aj_serialized":"ActiveJob::Serializers::SymbolSerializer","value":"email"},"_aj_symbol_keys":["force","channel"]},` +
+	`[1,{"_aj_serialized":"ActiveJob::Serializers::DurationSerializer","value":3600,"parts":[["hours",1]]}]` +
+	`],"executions":1,"exception_executions":{},"locale":"en","timezone":"UTC","enqueued_at":"2024-01-02T03:04:05.000000000Z"}]}`
+
+func TestDeserialize(t *testing.T) {
+	tests := []struct {
+		name string
+		arg  string
+		want string
+	}{
+		{name: "plain value", arg: `"foo"`, want: `"foo"`},
+		{name: "global id", arg: `{"_aj_globalid":"gid://app/User/1"}`, want: `"gid://app/User/1"`},
+		{
+			name: "symbol keys",
+			arg:  `{"a":1,"_aj_symbol_keys":["a"]}`,
+			want: `{"a":1}`,
+		},
+		{
+			name: "ruby2 keywords",
+			arg:  `{"a":1,"_aj_ruby2_keywords":["a"]}`,
+			want: `{"a":1}`,
+		},
+		{
+			name: "indifferent access",
+			arg:  `{"a":{"b":2,"_aj_symbol_keys":[]},"_aj_hash_with_indifferent_access":true}`,
+			want: `{"a":{"b":2}}`,
+		},
+		{
+			name: "custom serializer",
+			arg:  `{"_aj_serialized":"ActiveJob::Serializers::TimeWithZoneSerializer","value":"2024-01-02T03:04:05.000000000Z","time_zone":"UTC"}`,
+			want: `"2024-01-02T03:04:05.000000000Z"`,
+		},
+		{
+			name: "nested",
+			arg:  `[[{"_aj_globalid":"gid://app/User/1"}],{"u":{"_aj_globalid":"gid://app/User/2"}}]`,
+			want: `[["gid://app/User/1"],{"u":"gid://app/User/2"}]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := activejob.Deserialize(json.RawMessage(tt.arg))
+			assert.Eq(t, nil, err)
+			assert.Eq(t, tt.want, string(got))
+		})
+	}
+}
+
+func TestUnwrap(t *testing.T) {
+	tests := []struct {
+		name        string
+		payload     string
+		wantClass   string
+		wantID      string
+		wantAttempt int
+		wantArgs    []string
+		wantErrIs   error
+	}{
+		{
+			name:        "unwraps the activejob envelope",
+			payload:     envelope,
+			wantClass:   "SendInvoiceJob",
+			wantID:      "0b3c2f5e-4e1d-4d6e-9b1a-3c1f2e9d8a7b",
+			wantAttempt: 2,
+			wantArgs:    []string{`"gid://billing/Invoice/42"`, `{"channel":"email","force":true}`, `[1,3600]`},
+		},
+		{
+			name:        "returns the other jobs as is",
+			payload:     `{"class":"Mail","args":[1],"id":"j1"}`,
+			wantClass:   "Mail",
+			wantID:      "j1",
+			wantAttempt: 0,
+			wantArgs:    []string{`1`},
+		},
+		{
+			name:      "fails without job class",
+			payload:   `{"class":"ActiveJob::QueueAdapters::ResqueAdapter::JobWrapper","args":[{"arguments":[]}]}`,
+			wantErrIs: activejob.ErrInvalidEnvelope,
+		},
+		{
+			name:      "fails without the envelope",
+			payload:   `{"class":"ActiveJob::QueueAdapters::ResqueAdapter::JobWrapper","args":[]}`,
+			wantErrIs: activejob.ErrInvalidEnvelope,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jb := &job.Job{Queue: "mailers"}
+			if err := json.Unmarshal([]byte(tt.payload), &jb.Payload); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := activejob.Unwrap(jb)
+			if tt.wantErrIs != nil {
+				assert.Eq(t, true, errors.Is(err, tt.wantErrIs))
+				return
+			}
+
+			assert.Eq(t, nil, err)
+			assert.Eq(t, "mailers", got.Queue)
+			assert.Eq(t, tt.wantClass, got.Payload.Class)
+			assert.Eq(t, tt.wantID, got.Payload.ID)
+			assert.Eq(t, tt.wantAttempt, got.Payload.Attempt)
+			assert.Eq(t, len(tt.wantArgs), len(got.Payload.Args))
+
+			for i, arg := range tt.wantArgs {
+				assert.Eq(t, arg, string(got.Payload.Args[i]))
+			}
+		})
+	}
+}
+
+type plugin struct {
+	calls []string
+}
+
+func (p *plugin) BeforePerform(_ context.Context, _, class string, _ []json.RawMessage) error {
+	p.calls = append(p.calls, "BeforePerform "+class)
+	return nil
+}
+
+func (p *plugin) AfterPerform(_ context.Context, _, class string, _ []json.RawMessage, _ job.Result, err error) error {
+	p.calls = append(p.calls, "AfterPerform "+class)
+	return err
+}
+
+type handler struct {
+	plugin *plugin
+	args   []json.RawMessage
+	id     string
+}
+
+func (h *handler) Plugins() []job.Plugin {
+	return []job.Plugin{h.plugin}
+}
+
+func (h *handler) Perform(ctx context.Context, _, _ string, args []json.RawMessage) (job.Result, error) {
+	h.args = args
+	h.id = job.ID(ctx)
+
+	return "sent", nil
+}
+
+func TestHandlers(t *testing.T) {
+	h := &handler{plugin: &plugin{}}
+	handlers := activejob.Handlers(map[string]job.Handler{"SendInvoiceJob": h})
+
+	jb := &job.Job{Queue: "mailers"}
+	if err := json.Unmarshal([]byte(envelope), &jb.Payload); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := job.Run(context.Background(), handlers, jb)
+
+	assert.Eq(t, nil, err)
+	assert.Eq(t, "sent", res)
+	assert.Eq(t, "0b3c2f5e-4e1d-4d6e-9b1a-3c1f2e9d8a7b", h.id)
+	assert.Eq(t, 3, len(h.args))
+	assert.Eq(t, `"gid://billing/Invoice/42"`, string(h.args[0]))
+	assert.Eq(t, "BeforePerform SendInvoiceJob,AfterPerform SendInvoiceJob",
+		h.plugin.calls[0]+","+h.plugin.calls[1])
+
+	jb.Payload.Args = []json.RawMessage{json.RawMessage(`{"job_class":"Unknown","arguments":[]}`)}
+	_, err = job.Run(context.Background(), handlers, jb)
+	assert.Eq(t, true, errors.Is(err, job.ErrNoHandler))
+}
+
+func TestEnqueue(t *testing.T) {
+	rds := fakeredis.New()
+	q := queue.New(rds.Pool())
+
+	res, err := activejob.Enqueue(context.Background(), q, "mailers", "SendInvoiceJob", "gid://billing/Invoice/42",
+		map[string]bool{"force": true})
+	assert.Eq(t, nil, err)
+	assert.Eq(t, 1, res.Length)
+
+	items := rds.List("resque:queue:mailers")
+	assert.Eq(t, 1, len(items))
+
+	var payload struct {
+		Class string          `json:"class"`
+		Args  []activejob.Job `json:"args"`
+	}
+	if err := json.Unmarshal([]byte(items[0]), &payload); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Eq(t, activejob.WrapperClass, payload.Class)
+	assert.Eq(t, 1, len(payload.Args))
+	assert.Eq(t, "SendInvoiceJob", payload.Args[0].JobClass)
+	assert.Eq(t, "mailers", payload.Args[0].QueueName)
+	assert.Eq(t, 36, len(payload.Args[0].JobID))
+	assert.Eq(t, `"gid://billing/Invoice/42"`, string(payload.Args[0].Arguments[0]))
+	assert.Eq(t, `{"force":true}`, string(payload.Args[0].Arguments[1]))
+
+	// the envelope enqueued for Rails can be performed by goresq as well.
+	jb := &job.Job{Queue: "mailers"}
+	if err := json.Unmarshal([]byte(items[0]), &jb.Payload); err != nil {
+		t.Fatal(err)
+	}
+
+	inner, err := activejob.Unwrap(jb)
+	assert.Eq(t, nil, err)
+	assert.Eq(t, payload.Args[0].JobID, inner.Payload.ID)
+	assert.Eq(t, 1, inner.Payload.Attempt)
+}
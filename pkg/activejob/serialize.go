@@ -0,0 +1,71 @@
+package activejob
+
+import (
+	"encoding/json"
+)
+
+// The keys ActiveJob::Arguments uses to serialize the values which are not plain JSON.
+const (
+	keyGlobalID          = "_aj_globalid"
+	keySymbolKeys        = "_aj_symbol_keys"
+	keyRuby2Keywords     = "_aj_ruby2_keywords"
+	keyIndifferentAccess = "_aj_hash_with_indifferent_access"
+	keySerialized        = "_aj_serialized"
+	keySerializedValue   = "value"
+)
+
+// Deserialize converts an argument serialized by ActiveJob::Arguments into plain JSON:
+//
+//   - GlobalID references become their gid:// URI strings,
+//   - values of the custom serializers (symbols, times, durations, ...) become their
+//     serialized value,
+//   - the _aj_ markers of the hashes with symbol keys, ruby2 keywords and indifferent access
+//     are removed,
+//
+// recursively in arrays and hashes.
+func Deserialize(arg json.RawMessage) (json.RawMessage, error) {
+	var value interface{}
+	if err := json.Unmarshal(arg, &value); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(deserialize(value))
+}
+
+func deserialize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case []interface{}:
+		res := make([]interface{}, len(v))
+		for i, item := range v {
+			res[i] = deserialize(item)
+		}
+
+		return res
+
+	case map[string]interface{}:
+		if gid, ok := v[keyGlobalID]; ok && len(v) == 1 {
+			return gid
+		}
+
+		if _, ok := v[keySerialized]; ok {
+			if value, ok := v[keySerializedValue]; ok {
+				return deserialize(value)
+			}
+		}
+
+		res := make(map[string]interface{}, len(v))
+
+		for key, item := range v {
+			switch key {
+			case keySymbolKeys, keyRuby2Keywords, keyIndifferentAccess, keySerialized:
+				continue
+			}
+
+			res[key] = deserialize(item)
+		}
+
+		return res
+	}
+
+	return value
+}
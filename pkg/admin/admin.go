@@ -0,0 +1,347 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+
+	"github.com/snobb/goresq/pkg/db"
+	"github.com/snobb/goresq/pkg/failure"
+	"github.com/snobb/goresq/pkg/job"
+	"github.com/snobb/goresq/pkg/queue"
+	"github.com/snobb/goresq/pkg/stats"
+)
+
+// Admin inspects and operates the queues, the workers and the failed jobs using the same redis
+// keys as Resque.
+type Admin struct {
+	Namespace string
+	// FailureBackend stores the jobs of the pruned workers, see PruneWorkers. The failed list
+	// of the namespace is used by default. It affects PruneWorkers only: the failed jobs are
+	// listed, retried, removed and cleared in the failed list of the namespace, whatever the
+	// backend the workers save them to.
+	FailureBackend failure.Backend
+	pool           db.Pooler
+	mux            *http.ServeMux
+}
+
+// QueueInfo describes a queue.
+type QueueInfo struct {
+	Name string `json:"name"`
+	Size int    `json:"size"`
+}
+
+// WorkerInfo describes a registered worker.
+type WorkerInfo struct {
+	ID        string     `json:"id"`
+	Host      string     `json:"host"`
+	Pid       int        `json:"pid"`
+	Queues    []string   `json:"queues"`
+	StartedAt time.Time  `json:"started_at"`
+	Heartbeat *time.Time `json:"heartbeat,omitempty"`
+	Job       *WorkerJob `json:"job,omitempty"`
+}
+
+// WorkerJob describes the job a worker is running.
+type WorkerJob struct {
+	Queue   string      `json:"queue"`
+	RunAt   string      `json:"run_at"`
+	Payload job.Payload `json:"payload"`
+}
+
+// Stats represents the overall statistics.
+type Stats struct {
+	Processed int `json:"processed"`
+	Failed    int `json:"failed"`
+	Pending   int `json:"pending"`
+	Queues    int `json:"queues"`
+	Workers   int `json:"workers"`
+	Working   int `json:"working"`
+}
+
+// New creates a new Admin.
+func New(pool db.Pooler) *Admin {
+	a := &Admin{
+		Namespace: "resque",
+		pool:      pool,
+	}
+
+	a.routes()
+
+	return a
+}
+
+// Failures returns the list of the failed jobs, the <ns>:failed list of the Redis backend.
+// The admin handlers, the dashboard and the command line only support this backend; the jobs
+// saved to another one, such as failure.PerQueue, are not shown and can not be retried there.
+func (a *Admin) Failures() *failure.Redis {
+	failures := failure.NewRedis(a.pool)
+	failures.Namespace = a.Namespace
+
+	return failures
+}
+
+// Statistics returns the job counters.
+func (a *Admin) Statistics() *stats.Stats {
+	s := stats.New(a.pool)
+	s.Namespace = a.Namespace
+
+	return s
+}
+
+// Queue returns the queue operating the jobs.
+func (a *Admin) Queue() *queue.Queue {
+	q := queue.New(a.pool)
+	q.Namespace = a.Namespace
+
+	return q
+}
+
+// Queues returns the registered queues sorted by name with their sizes.
+func (a *Admin) Queues() ([]QueueInfo, error) {
+	q := a.Queue()
+
+	names, err := q.Queues()
+	if err != nil {
+		return nil, err
+	}
+
+	queues := make([]QueueInfo, 0, len(names))
+
+	for _, name := range names {
+		size, err := q.Size(name)
+		if err != nil {
+			return nil, err
+		}
+
+		queues = append(queues, QueueInfo{Name: name, Size: size})
+	}
+
+	return queues, nil
+}
+
+// Peek returns count jobs of the queue starting at the given index without removing them.
+func (a *Admin) Peek(queue string, start, count int) ([]job.Payload, error) {
+	return a.Queue().Peek(queue, start, count)
+}
+
+// RemoveQueue deletes the queue with all its jobs.
+func (a *Admin) RemoveQueue(queue string) error {
+	return a.Queue().RemoveQueue(queue)
+}
+
+// RemoveJobs removes the jobs of the class from the queue and returns the number of the removed
+// jobs. If args are given only the jobs with the same arguments are removed.
+func (a *Admin) RemoveJobs(ctx context.Context, queue, class string, args ...json.RawMessage) (int, error) {
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		values[i] = arg
+	}
+
+	return a.Queue().Dequeue(ctx, queue, class, values...)
+}
+
+// Workers returns the registered workers sorted by id with their last heartbeats and the jobs
+// they are running.
+func (a *Admin) Workers() ([]WorkerInfo, error) {
+	conn, err := a.pool.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	ids, err := redis.Strings(conn.Do("SMEMBERS", fmt.Sprintf("%s:workers", a.Namespace)))
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(ids)
+
+	heartbeats, err := redis.StringMap(conn.Do("HGETALL", fmt.Sprintf("%s:workers:heartbeat", a.Namespace)))
+	if err != nil {
+		return nil, err
+	}
+
+	workers := make([]WorkerInfo, 0, len(ids))
+
+	for _, id := range ids {
+		worker := parseWorkerID(id)
+
+		started, err := redis.String(conn.Do("GET", fmt.Sprintf("%s:worker:%s:started", a.Namespace, id)))
+		if err == nil {
+			worker.StartedAt = parseTime(started)
+		} else if !errors.Is(err, redis.ErrNil) {
+			return nil, err
+		}
+
+		if heartbeat, ok := heartbeats[id]; ok {
+			if t := parseTime(heartbeat); !t.IsZero() {
+				worker.Heartbeat = &t
+			}
+		}
+
+		buf, err := redis.Bytes(conn.Do("GET", fmt.Sprintf("%s:worker:%s", a.Namespace, id)))
+		if err == nil {
+			worker.Job = &WorkerJob{}
+			if err := json.Unmarshal(buf, worker.Job); err != nil {
+				return nil, err
+			}
+		} else if !errors.Is(err, redis.ErrNil) {
+			return nil, err
+		}
+
+		workers = append(workers, worker)
+	}
+
+	return workers, nil
+}
+
+// PruneWorkers unregisters the workers whose last heartbeat is older than maxAge, e.g. the
+// workers of the processes killed without a clean shutdown, and returns their ids. The jobs
+// the pruned workers were running are recorded as failed. The workers which have never sent
+// a heartbeat are left untouched.
+func (a *Admin) PruneWorkers(maxAge time.Duration) ([]string, error) {
+	workers, err := a.Workers()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := a.pool.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var failures failure.Backend = a.Failures()
+	if a.FailureBackend != nil {
+		failures = a.FailureBackend
+	}
+
+	pruned := []string{}
+
+	for _, worker := range workers {
+		if worker.Heartbeat == nil || time.Since(*worker.Heartbeat) <= maxAge {
+			continue
+		}
+
+		if worker.Job != nil {
+			jb := &job.Job{Queue: worker.Job.Queue, Payload: worker.Job.Payload}
+			f := failure.New(jb, worker.ID, fmt.Errorf("worker %s is dead", worker.ID))
+			f.Exception = "DirtyExit"
+
+			if err := failures.Save(conn, f); err != nil {
+				return pruned, err
+			}
+		}
+
+		cmds := [][]interface{}{
+			{"SREM", fmt.Sprintf("%s:workers", a.Namespace), worker.ID},
+			{"HDEL", fmt.Sprintf("%s:workers:heartbeat", a.Namespace), worker.ID},
+			{"DEL", fmt.Sprintf("%s:worker:%s", a.Namespace, worker.ID)},
+			{"DEL", fmt.Sprintf("%s:worker:%s:started", a.Namespace, worker.ID)},
+		}
+
+		for _, name := range stats.Names() {
+			cmds = append(cmds, []interface{}{"DEL", stats.WorkerKey(a.Namespace, worker.ID, name)})
+		}
+
+		for _, cmd := range cmds {
+			if err := conn.Send(cmd[0].(string), cmd[1:]...); err != nil {
+				return pruned, err
+			}
+		}
+
+		if _, err := conn.Do(""); err != nil {
+			return pruned, err
+		}
+
+		pruned = append(pruned, worker.ID)
+	}
+
+	return pruned, nil
+}
+
+// Stats returns the overall statistics.
+func (a *Admin) Stats() (*Stats, error) {
+	queues, err := a.Queues()
+	if err != nil {
+		return nil, err
+	}
+
+	workers, err := a.Workers()
+	if err != nil {
+		return nil, err
+	}
+
+	total, err := a.Statistics().Total()
+	if err != nil {
+		return nil, err
+	}
+
+	res := &Stats{
+		Processed: total.Processed,
+		Failed:    total.Failed,
+		Queues:    len(queues),
+		Workers:   len(workers),
+	}
+
+	for _, queue := range queues {
+		res.Pending += queue.Size
+	}
+
+	for _, worker := range workers {
+		if worker.Job != nil {
+			res.Working++
+		}
+	}
+
+	return res, nil
+}
+
+// parseWorkerID parses worker ids in the host:pid:queues format used by Resque. The pid part
+// may be suffixed as in host:pid-worker1:queues used by goresq.
+func parseWorkerID(id string) WorkerInfo {
+	worker := WorkerInfo{ID: id}
+
+	parts := strings.SplitN(id, ":", 3)
+	worker.Host = parts[0]
+
+	if len(parts) > 1 {
+		pid := parts[1]
+		if i := strings.IndexFunc(pid, func(r rune) bool { return r < '0' || r > '9' }); i >= 0 {
+			pid = pid[:i]
+		}
+
+		worker.Pid, _ = strconv.Atoi(pid)
+	}
+
+	if len(parts) > 2 {
+		worker.Queues = strings.Split(parts[2], ",")
+	}
+
+	return worker
+}
+
+// parseTime parses the worker start time stored as unix time by goresq or as a time string by
+// the other Resque implementations. The zero time is returned if the format is not known.
+func parseTime(value string) time.Time {
+	if ts, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(ts, 0)
+	}
+
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05 -0700", time.UnixDate} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+
+	return time.Time{}
+}
@@ -0,0 +1,285 @@
+package admin_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/snobb/goresq/pkg/admin"
+	"github.com/snobb/goresq/pkg/failure"
+
+	"github.com/snobb/goresq/test/assert"
+	"github.com/snobb/goresq/test/fakeredis"
+)
+
+const failed = `{"failed_at":"2024/01/02 03:04:05 UTC","payload":{"class":"Mail","args":[1]},` +
+	`"exception":"Error","error":"boom","backtrace":[],"worker":"host:1-worker1:mail","queue":"mail"}`
+
+func seed(t *testing.T) *fakeredis.Redis {
+	t.Helper()
+
+	rds := fakeredis.New()
+
+	rds.Seed(t, [][]interface{}{
+		{"SADD", "resque:queues", "mail", "default"},
+		{"RPUSH", "resque:queue:mail", `{"class":"Mail","args":[1]}`, `{"class":"Mail","args":[2]}`},
+		{"SADD", "resque:workers", "host:42-worker1:mail,default"},
+		{"SET", "resque:worker:host:42-worker1:mail,default:started", "1700000000"},
+		{"SET", "resque:worker:host:42-worker1:mail,default", `{"queue":"mail","run_at":"2024-01-02T03:04:05Z","payload":{"class":"Mail","args":[3]}}`},
+		{"HSET", "resque:workers:heartbeat", "host:42-worker1:mail,default", "2024-01-02T03:04:00Z"},
+		{"SET", "resque:stat:processed", "10"},
+		{"SET", "resque:stat:failed", "1"},
+		{"SET", "resque:stat:queue:mail:processed", "4"},
+		{"SET", "resque:stat:queue:mail:failed", "1"},
+		{"SET", "resque:stat:processed:host:42-worker1:mail,default", "5"},
+		{"RPUSH", "resque:failed", failed},
+	}...)
+
+	return rds
+}
+
+func TestAdmin_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		wantStatus int
+		wantBody   string
+		wantLists  map[string][]string
+	}{
+		{
+			name:       "list queues",
+			method:     http.MethodGet,
+			target:     "/queues",
+			wantStatus: http.StatusOK,
+			wantBody:   `[{"name":"default","size":0},{"name":"mail","size":2}]`,
+		},
+		{
+			name:       "peek queue jobs",
+			method:     http.MethodGet,
+			target:     "/queues/mail/jobs?start=1&count=5",
+			wantStatus: http.StatusOK,
+			wantBody:   `[{"class":"Mail","args":[2]}]`,
+		},
+		{
+			name:       "invalid pagination",
+			method:     http.MethodGet,
+			target:     "/queues/mail/jobs?count=x",
+			wantStatus: http.StatusBadRequest,
+			wantBody:   `{"error":"bad request: invalid count \"x\""}`,
+		},
+		{
+			name:       "remove queue jobs",
+			method:     http.MethodDelete,
+			target:     "/queues/mail/jobs?class=Mail",
+			wantStatus: http.StatusOK,
+			wantBody:   `{"removed":2}`,
+			wantLists:  map[string][]string{"resque:queue:mail": {}},
+		},
+		{
+			name:       "remove queue jobs without class",
+			method:     http.MethodDelete,
+			target:     "/queues/mail/jobs",
+			wantStatus: http.StatusBadRequest,
+			wantBody:   `{"error":"bad request: missing class"}`,
+		},
+		{
+			name:       "remove queue",
+			method:     http.MethodDelete,
+			target:     "/queues/mail",
+			wantStatus: http.StatusNoContent,
+			wantLists:  map[string][]string{"resque:queue:mail": {}},
+		},
+		{
+			name:       "list workers",
+			method:     http.MethodGet,
+			target:     "/workers",
+			wantStatus: http.StatusOK,
+			wantBody: `[{"id":"host:42-worker1:mail,default","host":"host","pid":42,"queues":["mail","default"],` +
+				`"started_at":"` + startedAt(t) + `","heartbeat":"2024-01-02T03:04:00Z","job":{"queue":"mail","run_at":"2024-01-02T03:04:05Z",` +
+				`"payload":{"class":"Mail","args":[3]}}}]`,
+		},
+		{
+			name:       "stats",
+			method:     http.MethodGet,
+			target:     "/stats",
+			wantStatus: http.StatusOK,
+			wantBody:   `{"processed":10,"failed":1,"pending":2,"queues":2,"workers":1,"working":1}`,
+		},
+		{
+			name:       "queue stats",
+			method:     http.MethodGet,
+			target:     "/stats/queues",
+			wantStatus: http.StatusOK,
+			wantBody:   `{"default":{"processed":0,"failed":0},"mail":{"processed":4,"failed":1}}`,
+		},
+		{
+			name:       "worker stats",
+			method:     http.MethodGet,
+			target:     "/stats/workers",
+			wantStatus: http.StatusOK,
+			wantBody:   `{"host:42-worker1:mail,default":{"processed":5,"failed":0}}`,
+		},
+		{
+			name:       "reset stats",
+			method:     http.MethodDelete,
+			target:     "/stats",
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:       "list failed",
+			method:     http.MethodGet,
+			target:     "/failed",
+			wantStatus: http.StatusOK,
+			wantBody:   `{"total":1,"jobs":[{"index":0,` + strings.TrimPrefix(failed, "{") + `]}`,
+		},
+		{
+			name:       "remove failed",
+			method:     http.MethodDelete,
+			target:     "/failed/0",
+			wantStatus: http.StatusNoContent,
+			wantLists:  map[string][]string{"resque:failed": {}},
+		},
+		{
+			name:       "remove missing failed",
+			method:     http.MethodDelete,
+			target:     "/failed/3",
+			wantStatus: http.StatusNotFound,
+			wantBody:   `{"error":"failure not found at index 3"}`,
+		},
+		{
+			name:       "retry failed",
+			method:     http.MethodPost,
+			target:     "/failed/0/retry",
+			wantStatus: http.StatusNoContent,
+			wantLists: map[string][]string{
+				"resque:queue:mail": {`{"class":"Mail","args":[1]}`, `{"class":"Mail","args":[2]}`, `{"class":"Mail","args":[1],"attempt":2}`},
+			},
+		},
+		{
+			name:       "clear failed",
+			method:     http.MethodDelete,
+			target:     "/failed",
+			wantStatus: http.StatusNoContent,
+			wantLists:  map[string][]string{"resque:failed": {}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rds := seed(t)
+			a := admin.New(rds.Pool())
+
+			rec := httptest.NewRecorder()
+			a.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.target, nil))
+
+			assert.Eq(t, tt.wantStatus, rec.Code)
+			assert.Eq(t, tt.wantBody, strings.TrimSpace(rec.Body.String()))
+
+			for key, want := range tt.wantLists {
+				got := rds.List(key)
+				assert.Eq(t, len(want), len(got))
+
+				for i := range want {
+					if i < len(got) {
+						assert.Eq(t, want[i], got[i])
+					}
+				}
+			}
+		})
+	}
+}
+
+func startedAt(t *testing.T) string {
+	t.Helper()
+
+	buf, err := time.Unix(1700000000, 0).MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(buf)
+}
+
+func TestAdmin_RemoveJobs(t *testing.T) {
+	tests := []struct {
+		name      string
+		class     string
+		args      []json.RawMessage
+		wantCount int
+		wantList  []string
+	}{
+		{
+			name:      "remove by class",
+			class:     "Mail",
+			wantCount: 3,
+			wantList:  []string{`{"class":"Sms","args":[1]}`},
+		},
+		{
+			name:      "remove by class and args",
+			class:     "Mail",
+			args:      []json.RawMessage{json.RawMessage(`{ "id": 1 }`)},
+			wantCount: 2,
+			wantList:  []string{`{"class":"Mail","args":[{"id":2}]}`, `{"class":"Sms","args":[1]}`},
+		},
+		{
+			name:     "nothing to remove",
+			class:    "Push",
+			wantList: []string{`{"class":"Mail","args":[{"id":1}]}`, `{"class":"Mail","args":[{"id":2}]}`, `{"class":"Sms","args":[1]}`, `{"class":"Mail","args":[{"id":1}]}`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rds := fakeredis.New()
+			_, _ = rds.Do("RPUSH", "resque:queue:mail", `{"class":"Mail","args":[{"id":1}]}`,
+				`{"class":"Mail","args":[{"id":2}]}`, `{"class":"Sms","args":[1]}`, `{"class":"Mail","args":[{"id":1}]}`)
+
+			n, err := admin.New(rds.Pool()).RemoveJobs(context.Background(), "mail", tt.class, tt.args...)
+
+			assert.Eq(t, nil, err)
+			assert.Eq(t, tt.wantCount, n)
+			assert.Eq(t, strings.Join(tt.wantList, "\n"), strings.Join(rds.List("resque:queue:mail"), "\n"))
+		})
+	}
+}
+
+func TestAdmin_PruneWorkers(t *testing.T) {
+	rds := seed(t)
+	now := time.Now().UTC().Format(time.RFC3339)
+	_, _ = rds.Do("SADD", "resque:workers", "host:43-worker1:mail", "host:44-worker1:mail")
+	_, _ = rds.Do("HSET", "resque:workers:heartbeat", "host:43-worker1:mail", now)
+
+	pruned, err := admin.New(rds.Pool()).PruneWorkers(time.Minute)
+
+	assert.Eq(t, nil, err)
+	assert.Eq(t, "host:42-worker1:mail,default", strings.Join(pruned, ","))
+	assert.Eq(t, "host:43-worker1:mail,host:44-worker1:mail", strings.Join(rds.Members("resque:workers"), ","))
+
+	_, ok := rds.Get("resque:worker:host:42-worker1:mail,default")
+	assert.Eq(t, false, ok)
+
+	failed := rds.List("resque:failed")
+	assert.Eq(t, 2, len(failed))
+	assert.Eq(t, true, strings.Contains(failed[1], `"exception":"DirtyExit"`))
+	assert.Eq(t, true, strings.Contains(failed[1], `"payload":{"class":"Mail","args":[3]}`))
+}
+
+func TestAdmin_PruneWorkersFailureBackend(t *testing.T) {
+	rds := seed(t)
+	failures := len(rds.List("resque:failed"))
+
+	a := admin.New(rds.Pool())
+	a.FailureBackend = failure.NewPerQueue("resque")
+
+	pruned, err := a.PruneWorkers(time.Minute)
+
+	assert.Eq(t, nil, err)
+	assert.Eq(t, "host:42-worker1:mail,default", strings.Join(pruned, ","))
+	assert.Eq(t, failures, len(rds.List("resque:failed")))
+	assert.Eq(t, 1, len(rds.List("resque:mail_failed")))
+}
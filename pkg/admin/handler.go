@@ -0,0 +1,282 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/snobb/goresq/pkg/failure"
+)
+
+const defaultCount = 20
+
+// ServeHTTP serves the JSON admin API:
+//
+//	GET    /queues                 queues with their sizes
+//	DELETE /queues/{queue}         delete the queue with all its jobs
+//	GET    /queues/{queue}/jobs    jobs in the queue, paginated with start and count
+//	DELETE /queues/{queue}/jobs    remove the jobs of the class query parameter
+//	GET    /workers                workers with their heartbeats and the jobs they are running
+//	GET    /stats                  overall statistics
+//	DELETE /stats                  reset the job counters
+//	GET    /stats/queues           job counters by queue
+//	GET    /stats/workers          job counters by worker
+//	GET    /failed                 failed jobs, paginated with start and count
+//	DELETE /failed                 remove all failed jobs
+//	POST   /failed/{index}/retry   retry a failed job
+//	DELETE /failed/{index}         remove a failed job
+//
+// The handler can be mounted under a prefix with http.StripPrefix.
+func (a *Admin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mux.ServeHTTP(w, r)
+}
+
+func (a *Admin) routes() {
+	a.mux = http.NewServeMux()
+	a.mux.HandleFunc("GET /queues", a.handleQueues)
+	a.mux.HandleFunc("DELETE /queues/{queue}", a.handleRemoveQueue)
+	a.mux.HandleFunc("GET /queues/{queue}/jobs", a.handleQueueJobs)
+	a.mux.HandleFunc("DELETE /queues/{queue}/jobs", a.handleRemoveJobs)
+	a.mux.HandleFunc("GET /workers", a.handleWorkers)
+	a.mux.HandleFunc("GET /stats", a.handleStats)
+	a.mux.HandleFunc("DELETE /stats", a.handleResetStats)
+	a.mux.HandleFunc("GET /stats/queues", a.handleQueueStats)
+	a.mux.HandleFunc("GET /stats/workers", a.handleWorkerStats)
+	a.mux.HandleFunc("GET /failed", a.handleFailed)
+	a.mux.HandleFunc("DELETE /failed", a.handleClearFailed)
+	a.mux.HandleFunc("POST /failed/{index}/retry", a.handleRetryFailed)
+	a.mux.HandleFunc("DELETE /failed/{index}", a.handleRemoveFailed)
+}
+
+func (a *Admin) handleQueues(w http.ResponseWriter, _ *http.Request) {
+	queues, err := a.Queues()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, queues)
+}
+
+func (a *Admin) handleQueueJobs(w http.ResponseWriter, r *http.Request) {
+	start, count, err := pagination(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	jobs, err := a.Peek(r.PathValue("queue"), start, count)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, jobs)
+}
+
+func (a *Admin) handleRemoveQueue(w http.ResponseWriter, r *http.Request) {
+	if err := a.RemoveQueue(r.PathValue("queue")); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *Admin) handleRemoveJobs(w http.ResponseWriter, r *http.Request) {
+	class := r.URL.Query().Get("class")
+	if class == "" {
+		writeError(w, fmt.Errorf("%w: missing class", errBadRequest))
+		return
+	}
+
+	removed, err := a.RemoveJobs(r.Context(), r.PathValue("queue"), class)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		Removed int `json:"removed"`
+	}{removed})
+}
+
+func (a *Admin) handleWorkers(w http.ResponseWriter, _ *http.Request) {
+	workers, err := a.Workers()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, workers)
+}
+
+func (a *Admin) handleStats(w http.ResponseWriter, _ *http.Request) {
+	stats, err := a.Stats()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, stats)
+}
+
+func (a *Admin) handleResetStats(w http.ResponseWriter, _ *http.Request) {
+	if err := a.Statistics().Reset(); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *Admin) handleQueueStats(w http.ResponseWriter, _ *http.Request) {
+	counts, err := a.Statistics().Queues()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, counts)
+}
+
+func (a *Admin) handleWorkerStats(w http.ResponseWriter, _ *http.Request) {
+	counts, err := a.Statistics().Workers()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, counts)
+}
+
+func (a *Admin) handleFailed(w http.ResponseWriter, r *http.Request) {
+	start, count, err := pagination(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	failures := a.Failures()
+
+	total, err := failures.Count()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	items, err := failures.Range(start, count)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	type indexed struct {
+		Index int `json:"index"`
+		*failure.Failure
+	}
+
+	jobs := make([]indexed, len(items))
+	for i, item := range items {
+		jobs[i] = indexed{Index: start + i, Failure: item}
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		Total int       `json:"total"`
+		Jobs  []indexed `json:"jobs"`
+	}{total, jobs})
+}
+
+func (a *Admin) handleClearFailed(w http.ResponseWriter, _ *http.Request) {
+	if err := a.Failures().Clear(); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *Admin) handleRetryFailed(w http.ResponseWriter, r *http.Request) {
+	index, err := pathIndex(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if err := a.Failures().Retry(index); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *Admin) handleRemoveFailed(w http.ResponseWriter, r *http.Request) {
+	index, err := pathIndex(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if err := a.Failures().Remove(index); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// errBadRequest marks the errors caused by invalid request parameters.
+var errBadRequest = errors.New("bad request")
+
+func pagination(r *http.Request) (start, count int, err error) {
+	start, count = 0, defaultCount
+
+	for name, dst := range map[string]*int{"start": &start, "count": &count} {
+		value := r.URL.Query().Get(name)
+		if value == "" {
+			continue
+		}
+
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return 0, 0, fmt.Errorf("%w: invalid %s %q", errBadRequest, name, value)
+		}
+
+		*dst = n
+	}
+
+	return start, count, nil
+}
+
+func pathIndex(r *http.Request) (int, error) {
+	index, err := strconv.Atoi(r.PathValue("index"))
+	if err != nil || index < 0 {
+		return 0, fmt.Errorf("%w: invalid index %q", errBadRequest, r.PathValue("index"))
+	}
+
+	return index, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+
+	switch {
+	case errors.Is(err, errBadRequest):
+		status = http.StatusBadRequest
+	case errors.Is(err, failure.ErrNotFound):
+		status = http.StatusNotFound
+	}
+
+	writeJSON(w, status, struct {
+		Error string `json:"error"`
+	}{err.Error()})
+}
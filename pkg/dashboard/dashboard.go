@@ -0,0 +1,39 @@
+package dashboard
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+
+	"github.com/snobb/goresq/pkg/admin"
+)
+
+//go:embed static
+var static embed.FS
+
+// Dashboard serves a read-mostly HTML dashboard showing the queues, the workers, the stat
+// counters and the failed jobs. The page is backed by the admin API served under /api/, so
+// only the failed jobs of the <ns>:failed list are shown, see admin.Admin.Failures.
+type Dashboard struct {
+	mux *http.ServeMux
+}
+
+// New creates a new dashboard on top of the admin API. The handler can be mounted under a prefix
+// with http.StripPrefix as the page only uses relative URLs.
+func New(a *admin.Admin) *Dashboard {
+	assets, err := fs.Sub(static, "static")
+	if err != nil {
+		panic(err)
+	}
+
+	d := &Dashboard{mux: http.NewServeMux()}
+	d.mux.Handle("/api/", http.StripPrefix("/api", a))
+	d.mux.Handle("/", http.FileServer(http.FS(assets)))
+
+	return d
+}
+
+// ServeHTTP serves the dashboard page and the admin API.
+func (d *Dashboard) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.mux.ServeHTTP(w, r)
+}
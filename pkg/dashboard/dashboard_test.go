@@ -0,0 +1,62 @@
+package dashboard_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/snobb/goresq/pkg/admin"
+	"github.com/snobb/goresq/pkg/dashboard"
+
+	"github.com/snobb/goresq/test/assert"
+	"github.com/snobb/goresq/test/fakeredis"
+)
+
+func TestDashboard_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name        string
+		target      string
+		wantStatus  int
+		wantType    string
+		wantContain string
+	}{
+		{
+			name:        "serves the page",
+			target:      "/",
+			wantStatus:  http.StatusOK,
+			wantType:    "text/html; charset=utf-8",
+			wantContain: "<title>goresq</title>",
+		},
+		{
+			name:        "serves the api",
+			target:      "/api/stats",
+			wantStatus:  http.StatusOK,
+			wantType:    "application/json",
+			wantContain: `"pending":1`,
+		},
+		{
+			name:       "unknown asset",
+			target:     "/missing.js",
+			wantStatus: http.StatusNotFound,
+			wantType:   "text/plain; charset=utf-8",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rds := fakeredis.New()
+			_, _ = rds.Do("SADD", "resque:queues", "default")
+			_, _ = rds.Do("RPUSH", "resque:queue:default", `{"class":"Test","args":[]}`)
+
+			d := dashboard.New(admin.New(rds.Pool()))
+
+			rec := httptest.NewRecorder()
+			d.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.target, nil))
+
+			assert.Eq(t, tt.wantStatus, rec.Code)
+			assert.Eq(t, tt.wantType, rec.Header().Get("Content-Type"))
+			assert.Eq(t, true, strings.Contains(rec.Body.String(), tt.wantContain))
+		})
+	}
+}
@@ -43,6 +43,15 @@ type Pool struct {
 	pool *redis.Pool
 }
 
+// Stats represents the redis pool usage.
+type Stats struct {
+	// ActiveCount is the number of connections in the pool, both idle and in use.
+	ActiveCount int
+
+	// IdleCount is the number of idle connections in the pool.
+	IdleCount int
+}
+
 // Conn represents a redis connection
 type Conn redis.Conn
 
@@ -93,6 +102,16 @@ func (r *Pool) Conn() (Conn, error) {
 	return conn, err
 }
 
+// Stats returns the redis pool usage.
+func (r *Pool) Stats() Stats {
+	stats := r.pool.Stats()
+
+	return Stats{
+		ActiveCount: stats.ActiveCount,
+		IdleCount:   stats.IdleCount,
+	}
+}
+
 // Close closes the redis pool
 func (r *Pool) Close() error {
 	return r.pool.Close()
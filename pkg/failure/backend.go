@@ -0,0 +1,66 @@
+package failure
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/snobb/goresq/pkg/db"
+)
+
+// Backend stores the failed jobs. Save sends the commands without flushing the connection.
+type Backend interface {
+	Save(conn db.Conn, f *Failure) error
+}
+
+// PerQueue keeps the failed jobs of every queue in its own <ns>:<queue>_failed list and the
+// names of the lists in the <ns>:failed_queues set, the same way the Resque RedisMultiQueue
+// backend does. The admin, the dashboard and the command line do not read these lists.
+type PerQueue struct {
+	Namespace string
+}
+
+// NewPerQueue creates a new per-queue failure backend in the namespace.
+func NewPerQueue(namespace string) *PerQueue {
+	return &PerQueue{Namespace: namespace}
+}
+
+// Key returns the key of the failed jobs list of the queue.
+func (p *PerQueue) Key(queue string) string {
+	return fmt.Sprintf("%s:%s_failed", p.Namespace, queue)
+}
+
+// Save pushes the failure to the list of its queue.
+func (p *PerQueue) Save(conn db.Conn, f *Failure) error {
+	buf, err := json.Marshal(f)
+	if err != nil {
+		return fmt.Errorf("marshal failed during %w for failure %v", err, f)
+	}
+
+	if err := conn.Send("RPUSH", p.Key(f.Queue), buf); err != nil {
+		return err
+	}
+
+	return conn.Send("SADD", fmt.Sprintf("%s:failed_queues", p.Namespace), f.Queue+"_failed")
+}
+
+// Multi saves the failures to all of its backends, stopping at the first error.
+type Multi []Backend
+
+// Save saves the failure to every backend.
+func (m Multi) Save(conn db.Conn, f *Failure) error {
+	for _, b := range m {
+		if err := b.Save(conn, f); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Nop discards the failures.
+type Nop struct{}
+
+// Save does nothing.
+func (Nop) Save(_ db.Conn, _ *Failure) error {
+	return nil
+}
@@ -0,0 +1,35 @@
+package failure
+
+import (
+	"time"
+
+	"github.com/snobb/goresq/pkg/job"
+)
+
+// TimeFormat is the format of the failure timestamps used by Resque.
+const TimeFormat = "2006/01/02 15:04:05 MST"
+
+// Failure represents a failed job in the format used by Resque.
+type Failure struct {
+	FailedAt  string      `json:"failed_at"`
+	Payload   job.Payload `json:"payload"`
+	Exception string      `json:"exception"`
+	Error     string      `json:"error"`
+	Backtrace []string    `json:"backtrace"`
+	Worker    string      `json:"worker"`
+	Queue     string      `json:"queue"`
+	RetriedAt string      `json:"retried_at,omitempty"`
+}
+
+// New creates a new failure of the job performed by the worker.
+func New(jb *job.Job, worker string, err error) *Failure {
+	return &Failure{
+		FailedAt:  time.Now().Format(TimeFormat),
+		Payload:   jb.Payload,
+		Exception: "Error",
+		Error:     err.Error(),
+		Backtrace: []string{},
+		Worker:    worker,
+		Queue:     jb.Queue,
+	}
+}
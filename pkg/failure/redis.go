@@ -0,0 +1,183 @@
+package failure
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+
+	"github.com/snobb/goresq/pkg/db"
+)
+
+// ErrNotFound is returned when there is no failure at the given index.
+var ErrNotFound = errors.New("failure not found")
+
+// Redis keeps the failed jobs in the <ns>:failed redis list the same way Resque does.
+type Redis struct {
+	Namespace string
+	pool      db.Pooler
+}
+
+// NewRedis creates a new failed jobs list.
+func NewRedis(pool db.Pooler) *Redis {
+	return &Redis{
+		Namespace: "resque",
+		pool:      pool,
+	}
+}
+
+func (r *Redis) key() string {
+	return fmt.Sprintf("%s:failed", r.Namespace)
+}
+
+// Save pushes the failure to the list. The command is sent without flushing the connection.
+func (r *Redis) Save(conn db.Conn, f *Failure) error {
+	buf, err := json.Marshal(f)
+	if err != nil {
+		return fmt.Errorf("marshal failed during %w for failure %v", err, f)
+	}
+
+	return conn.Send("RPUSH", r.key(), buf)
+}
+
+// Count returns the number of the failed jobs.
+func (r *Redis) Count() (int, error) {
+	conn, err := r.pool.Conn()
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	return redis.Int(conn.Do("LLEN", r.key()))
+}
+
+// Range returns count failures starting at the given index.
+func (r *Redis) Range(start, count int) ([]*Failure, error) {
+	if count <= 0 {
+		return []*Failure{}, nil
+	}
+
+	conn, err := r.pool.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	items, err := redis.ByteSlices(conn.Do("LRANGE", r.key(), start, start+count-1))
+	if err != nil {
+		return nil, err
+	}
+
+	failures := make([]*Failure, 0, len(items))
+
+	for _, item := range items {
+		var f Failure
+		if err := json.Unmarshal(item, &f); err != nil {
+			return nil, err
+		}
+
+		failures = append(failures, &f)
+	}
+
+	return failures, nil
+}
+
+// Retry pushes the failed job at the given index back to its queue and marks the failure as
+// retried. The job keeps its id and metadata and its attempt number is incremented.
+func (r *Redis) Retry(index int) error {
+	conn, err := r.pool.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	f, err := r.get(conn, index)
+	if err != nil {
+		return err
+	}
+
+	f.RetriedAt = time.Now().Format(TimeFormat)
+
+	buf, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+
+	retried := f.Payload
+	retried.Attempt = max(retried.Attempt, 1) + 1
+
+	payload, err := json.Marshal(retried)
+	if err != nil {
+		return err
+	}
+
+	if _, err := conn.Do("LSET", r.key(), index, buf); err != nil {
+		return err
+	}
+
+	if _, err := conn.Do("RPUSH", fmt.Sprintf("%s:queue:%s", r.Namespace, f.Queue), payload); err != nil {
+		return err
+	}
+
+	_, err = conn.Do("SADD", fmt.Sprintf("%s:queues", r.Namespace), f.Queue)
+
+	return err
+}
+
+// Remove removes the failure at the given index.
+func (r *Redis) Remove(index int) error {
+	conn, err := r.pool.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := r.get(conn, index); err != nil {
+		return err
+	}
+
+	// the value is replaced with a sentinel first so that the right item is removed even if
+	// there are several identical failures.
+	const sentinel = ""
+
+	if _, err := conn.Do("LSET", r.key(), index, sentinel); err != nil {
+		return err
+	}
+
+	_, err = conn.Do("LREM", r.key(), 1, sentinel)
+
+	return err
+}
+
+// Clear removes all the failures.
+func (r *Redis) Clear() error {
+	conn, err := r.pool.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Do("DEL", r.key())
+
+	return err
+}
+
+func (r *Redis) get(conn db.Conn, index int) (*Failure, error) {
+	item, err := redis.Bytes(conn.Do("LINDEX", r.key(), index))
+	if errors.Is(err, redis.ErrNil) {
+		return nil, fmt.Errorf("%w at index %d", ErrNotFound, index)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var f Failure
+	if err := json.Unmarshal(item, &f); err != nil {
+		return nil, err
+	}
+
+	return &f, nil
+}
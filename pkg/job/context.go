@@ -0,0 +1,89 @@
+package job
+
+import (
+	"context"
+	"time"
+)
+
+// Execution describes the job being performed.
+type Execution struct {
+	Job
+
+	// Worker is the id of the worker performing the job. It is empty for the jobs performed
+	// inline by the queue.
+	Worker string
+
+	// StartedAt is the time the job has been started.
+	StartedAt time.Time
+}
+
+// Attempt returns the attempt number of the job starting from 1.
+func (e *Execution) Attempt() int {
+	return max(e.Payload.Attempt, 1)
+}
+
+type (
+	executionKey struct{}
+	workerKey    struct{}
+)
+
+// NewContext returns a copy of the context carrying the job execution. Run passes such a
+// context to the plugins and to Perform.
+func NewContext(ctx context.Context, e *Execution) context.Context {
+	return context.WithValue(ctx, executionKey{}, e)
+}
+
+// FromContext returns the execution of the job being performed.
+func FromContext(ctx context.Context) (*Execution, bool) {
+	e, ok := ctx.Value(executionKey{}).(*Execution)
+	return e, ok
+}
+
+// WithWorker returns a copy of the context carrying the id of the worker the jobs run with it
+// are performed by.
+func WithWorker(ctx context.Context, worker string) context.Context {
+	return context.WithValue(ctx, workerKey{}, worker)
+}
+
+func workerFromContext(ctx context.Context) string {
+	worker, _ := ctx.Value(workerKey{}).(string)
+	return worker
+}
+
+// ID returns the id of the job being performed or an empty string if it is not known.
+func ID(ctx context.Context) string {
+	if e, ok := FromContext(ctx); ok {
+		return e.Payload.ID
+	}
+
+	return ""
+}
+
+// EnqueuedAt returns the time the job being performed was enqueued or the zero time if it is
+// not known.
+func EnqueuedAt(ctx context.Context) time.Time {
+	if e, ok := FromContext(ctx); ok && e.Payload.EnqueuedAt > 0 {
+		return Time(e.Payload.EnqueuedAt)
+	}
+
+	return time.Time{}
+}
+
+// Attempt returns the attempt number of the job being performed. The jobs without the attempt
+// number are on their first attempt.
+func Attempt(ctx context.Context) int {
+	if e, ok := FromContext(ctx); ok {
+		return e.Attempt()
+	}
+
+	return 1
+}
+
+// Metadata returns the headers of the job being performed. The map must not be modified.
+func Metadata(ctx context.Context) map[string]string {
+	if e, ok := FromContext(ctx); ok {
+		return e.Payload.Metadata
+	}
+
+	return nil
+}
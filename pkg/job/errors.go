@@ -0,0 +1,31 @@
+package job
+
+import "errors"
+
+var (
+	// ErrNoHandler is returned when there is no handler registered for the job class.
+	ErrNoHandler = errors.New("no handler for job class")
+
+	// ErrPlugin is returned when a job plugin fails.
+	ErrPlugin = errors.New("plugin failed")
+
+	// ErrSkip is returned by a BeforePerform plugin or by Perform to drop the job without
+	// recording it as failed. The job is logged at the debug level and counted as skipped.
+	ErrSkip = errors.New("job skipped")
+
+	// ErrRequeue is returned by a BeforePerform plugin or by Perform to push the job back to
+	// the end of its queue, without recording it as failed.
+	ErrRequeue = errors.New("job requeued")
+
+	// ErrDiscard drops the job the same way as ErrSkip does. The only differences are that the
+	// job is logged at the info level and counted as discarded, so that the jobs dropped on
+	// purpose can be told apart from the routine skips.
+	ErrDiscard = errors.New("job discarded")
+)
+
+// Aborted reports whether the job has been aborted with ErrSkip, ErrRequeue or ErrDiscard
+// rather than failed. Like a Resque DontPerform, an aborted job skips the AfterPerform and the
+// FailurePlugins.
+func Aborted(err error) bool {
+	return errors.Is(err, ErrSkip) || errors.Is(err, ErrRequeue) || errors.Is(err, ErrDiscard)
+}
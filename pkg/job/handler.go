@@ -17,6 +17,13 @@ type Plugin interface {
 	AfterPerform(ctx context.Context, queue, class string, args []json.RawMessage, result Result, err error) error
 }
 
+// FailurePlugin is implemented by the plugins which must run only when the job fails. OnFailure
+// is called once the AfterPerform plugins have run, with the final error of the job, or with
+// the error of the BeforePerform plugin which has failed.
+type FailurePlugin interface {
+	OnFailure(ctx context.Context, queue, class string, args []json.RawMessage, err error) error
+}
+
 // Handler represents a job Handler.
 type Handler interface {
 	// Plugins returns a list of registered plugins with the handler.
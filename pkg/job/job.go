@@ -1,11 +1,32 @@
 package job
 
-import "encoding/json"
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"time"
+)
 
 // Payload represents a job payload
 type Payload struct {
 	Class string            `json:"class"`
 	Args  []json.RawMessage `json:"args"`
+
+	// ID is the unique id of the job set by the queue. It is not set by the other producers
+	// and is empty if missing.
+	ID string `json:"id,omitempty"`
+
+	// EnqueuedAt is the unix time in seconds the job was pushed to the queue. It is not set
+	// by all the producers and is zero if missing.
+	EnqueuedAt float64 `json:"enqueued_at,omitempty"`
+
+	// Attempt is the number of the attempt to perform the job starting from 1. It is
+	// incremented when a failed job is retried and is zero if not set by the producer.
+	Attempt int `json:"attempt,omitempty"`
+
+	// Metadata carries the headers propagated from the producer to the worker, e.g. the trace
+	// context.
+	Metadata map[string]string `json:"metadata,omitempty"`
 }
 
 // Job represents a resque job
@@ -13,3 +34,26 @@ type Job struct {
 	Queue   string
 	Payload Payload
 }
+
+// Timestamp converts the time into unix time in seconds.
+func Timestamp(t time.Time) float64 {
+	return float64(t.UnixNano()) / float64(time.Second)
+}
+
+// Time converts unix time in seconds into time.
+func Time(ts float64) time.Time {
+	return time.Unix(0, int64(ts*float64(time.Second)))
+}
+
+// NewID returns a new random job id formatted as a version 4 UUID.
+func NewID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -0,0 +1,80 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Run finds a handler for the job class and performs the job with the handler plugins run
+// before and after it, and the FailurePlugins run when it or a BeforePerform plugin fails.
+// Errors returned by the plugins are wrapped with ErrPlugin unless an AfterPerform plugin
+// passes the job error through unchanged; the errors of the FailurePlugins are joined to the
+// job error. The context passed to the plugins and to Perform carries the job execution, see
+// FromContext. A job aborted with ErrSkip, ErrRequeue or ErrDiscard is not passed to the
+// AfterPerform plugins nor to the FailurePlugins.
+func Run(ctx context.Context, handlers map[string]Handler, jb *Job) (result Result, err error) {
+	handler, ok := handlers[jb.Payload.Class]
+	if !ok {
+		return nil, fmt.Errorf("%w %s", ErrNoHandler, jb.Payload.Class)
+	}
+
+	ctx = NewContext(ctx, &Execution{Job: *jb, Worker: workerFromContext(ctx), StartedAt: time.Now()})
+
+	defer func() {
+		if err == nil || Aborted(err) {
+			return
+		}
+
+		for _, plugin := range handler.Plugins() {
+			if fp, ok := plugin.(FailurePlugin); ok {
+				if ferr := fp.OnFailure(ctx, jb.Queue, jb.Payload.Class, jb.Payload.Args, err); ferr != nil {
+					err = errors.Join(err, pluginError(plugin, ferr))
+				}
+			}
+		}
+	}()
+
+	for _, plugin := range handler.Plugins() {
+		if err = plugin.BeforePerform(ctx, jb.Queue, jb.Payload.Class, jb.Payload.Args); err != nil {
+			return nil, pluginError(plugin, err)
+		}
+	}
+
+	defer func() {
+		if Aborted(err) {
+			return
+		}
+
+		for _, plugin := range handler.Plugins() {
+			perr := plugin.AfterPerform(ctx, jb.Queue, jb.Payload.Class, jb.Payload.Args, result, err)
+			if perr != nil && perr != err { //nolint:errorlint // the job error passed through as is
+				err = pluginError(plugin, perr)
+			} else {
+				err = perr
+			}
+
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	result, err = handler.Perform(ctx, jb.Queue, jb.Payload.Class, jb.Payload.Args)
+	return
+}
+
+func pluginError(plugin Plugin, err error) error {
+	// the plugins wrapped by a middleware such as the tracer are named after the inner plugin.
+	for {
+		w, ok := plugin.(interface{ Unwrap() Plugin })
+		if !ok {
+			break
+		}
+
+		plugin = w.Unwrap()
+	}
+
+	return fmt.Errorf("%w: %T: %w", ErrPlugin, plugin, err)
+}
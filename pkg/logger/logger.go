@@ -0,0 +1,87 @@
+package logger
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Field keys used by the poller, the workers and the queue.
+const (
+	KeyWorker   = "worker"
+	KeyQueue    = "queue"
+	KeyQueues   = "queues"
+	KeyClass    = "class"
+	KeyJobID    = "job_id"
+	KeyAttempt  = "attempt"
+	KeyDuration = "duration"
+	KeyError    = "error"
+)
+
+// Field is a key-value pair attached to a log entry.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// F creates a new field.
+func F(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Logger is a structured logger.
+type Logger interface {
+	// Debug logs a message at debug level.
+	Debug(msg string, fields ...Field)
+
+	// Info logs a message at info level.
+	Info(msg string, fields ...Field)
+
+	// Error logs a message at error level.
+	Error(msg string, fields ...Field)
+}
+
+// Nop is a logger that discards all the messages.
+type Nop struct{}
+
+// Debug logs a message at debug level.
+func (Nop) Debug(_ string, _ ...Field) {}
+
+// Info logs a message at info level.
+func (Nop) Info(_ string, _ ...Field) {}
+
+// Error logs a message at error level.
+func (Nop) Error(_ string, _ ...Field) {}
+
+type slogLogger struct {
+	log *slog.Logger
+}
+
+// Slog creates a logger writing to the given slog logger.
+func Slog(log *slog.Logger) Logger {
+	return &slogLogger{log: log}
+}
+
+// Debug logs a message at debug level.
+func (s *slogLogger) Debug(msg string, fields ...Field) {
+	s.log.LogAttrs(context.Background(), slog.LevelDebug, msg, attrs(fields)...)
+}
+
+// Info logs a message at info level.
+func (s *slogLogger) Info(msg string, fields ...Field) {
+	s.log.LogAttrs(context.Background(), slog.LevelInfo, msg, attrs(fields)...)
+}
+
+// Error logs a message at error level.
+func (s *slogLogger) Error(msg string, fields ...Field) {
+	s.log.LogAttrs(context.Background(), slog.LevelError, msg, attrs(fields)...)
+}
+
+func attrs(fields []Field) []slog.Attr {
+	res := make([]slog.Attr, len(fields))
+
+	for i, f := range fields {
+		res[i] = slog.Any(f.Key, f.Value)
+	}
+
+	return res
+}
@@ -0,0 +1,71 @@
+package logger_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/snobb/goresq/pkg/logger"
+	"github.com/snobb/goresq/test/assert"
+)
+
+func TestSlog(t *testing.T) {
+	tests := []struct {
+		name      string
+		log       func(l logger.Logger)
+		wantLevel string
+		wantMsg   string
+		wantAttrs map[string]interface{}
+	}{
+		{
+			name: "should log at debug level",
+			log: func(l logger.Logger) {
+				l.Debug("job started", logger.F(logger.KeyQueue, "queue1"), logger.F(logger.KeyClass, "foo"))
+			},
+			wantLevel: "DEBUG",
+			wantMsg:   "job started",
+			wantAttrs: map[string]interface{}{"queue": "queue1", "class": "foo"},
+		},
+		{
+			name: "should log at info level",
+			log: func(l logger.Logger) {
+				l.Info("job finished", logger.F(logger.KeyDuration, time.Second))
+			},
+			wantLevel: "INFO",
+			wantMsg:   "job finished",
+			wantAttrs: map[string]interface{}{"duration": float64(time.Second)},
+		},
+		{
+			name: "should log at error level",
+			log: func(l logger.Logger) {
+				l.Error("poll failed", logger.F(logger.KeyError, "spanner"))
+			},
+			wantLevel: "ERROR",
+			wantMsg:   "poll failed",
+			wantAttrs: map[string]interface{}{"error": "spanner"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			handler := slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})
+
+			tt.log(logger.Slog(slog.New(handler)))
+
+			var entry map[string]interface{}
+			if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+				t.Fatalf("could not decode the log entry %q: %v", buf.String(), err)
+			}
+
+			assert.Eq(t, tt.wantLevel, entry["level"])
+			assert.Eq(t, tt.wantMsg, entry["msg"])
+
+			for k, v := range tt.wantAttrs {
+				assert.Eq(t, v, entry[k])
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package metrics
+
+import "time"
+
+// Outcome values reported for the processed jobs.
+const (
+	OutcomeSuccess   = "success"
+	OutcomeFailure   = "failure"
+	OutcomeSkipped   = "skipped"
+	OutcomeRequeued  = "requeued"
+	OutcomeDiscarded = "discarded"
+)
+
+// Recorder receives measurements from the queue, the poller and the workers.
+type Recorder interface {
+	// JobEnqueued is called after a job has been pushed to the queue.
+	JobEnqueued(queue, class string)
+
+	// JobStarted is called when a worker starts a job. The wait is the time the job spent
+	// in the queue or zero if it is not known.
+	JobStarted(queue, class string, wait time.Duration)
+
+	// JobFinished is called when a worker finishes a job with the given outcome.
+	JobFinished(queue, class, outcome string, duration time.Duration)
+
+	// PollError is called when the poller fails to fetch a job.
+	PollError()
+}
+
+// Nop is a recorder that discards all measurements.
+type Nop struct{}
+
+// JobEnqueued is called after a job has been pushed to the queue.
+func (Nop) JobEnqueued(_, _ string) {}
+
+// JobStarted is called when a worker starts a job.
+func (Nop) JobStarted(_, _ string, _ time.Duration) {}
+
+// JobFinished is called when a worker finishes a job with the given outcome.
+func (Nop) JobFinished(_, _, _ string, _ time.Duration) {}
+
+// PollError is called when the poller fails to fetch a job.
+func (Nop) PollError() {}
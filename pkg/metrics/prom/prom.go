@@ -0,0 +1,195 @@
+package prom
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/snobb/goresq/pkg/db"
+	"github.com/snobb/goresq/pkg/metrics"
+)
+
+const namespace = "goresq"
+
+// Metrics is a prometheus collector implementing metrics.Recorder. Queue depths and redis pool
+// usage are read when the collector is scraped.
+type Metrics struct {
+	Namespace string
+	pool      db.Pooler
+
+	enqueued   *prometheus.CounterVec
+	processed  *prometheus.CounterVec
+	duration   *prometheus.HistogramVec
+	wait       *prometheus.HistogramVec
+	inFlight   *prometheus.GaugeVec
+	pollErrors prometheus.Counter
+
+	depthDesc *prometheus.Desc
+	poolDesc  *prometheus.Desc
+}
+
+var _ metrics.Recorder = &Metrics{}
+
+// New creates a new prometheus collector reading queue depths from the given pool.
+func New(pool db.Pooler) *Metrics {
+	return &Metrics{
+		Namespace: "resque",
+		pool:      pool,
+		enqueued: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "jobs_enqueued_total",
+			Help:      "Number of jobs pushed to the queues.",
+		}, []string{"queue", "class"}),
+		processed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "jobs_processed_total",
+			Help:      "Number of jobs processed by the workers.",
+		}, []string{"queue", "class", "outcome"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "job_duration_seconds",
+			Help:      "Time spent performing the jobs.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"queue", "class"}),
+		wait: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "job_wait_seconds",
+			Help:      "Time the jobs spent in the queue before being started.",
+			Buckets:   prometheus.ExponentialBuckets(0.01, 4, 10),
+		}, []string{"queue"}),
+		inFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "jobs_in_flight",
+			Help:      "Number of jobs being performed.",
+		}, []string{"queue"}),
+		pollErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "poll_errors_total",
+			Help:      "Number of failed attempts to fetch a job.",
+		}),
+		depthDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "queue_depth"),
+			"Number of jobs waiting in the queue.",
+			[]string{"queue"}, nil,
+		),
+		poolDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "redis_pool_connections"),
+			"Number of redis connections in the pool.",
+			[]string{"state"}, nil,
+		),
+	}
+}
+
+// Register registers the collector with the given registry.
+func (m *Metrics) Register(reg prometheus.Registerer) error {
+	return reg.Register(m)
+}
+
+// Handler returns a http handler exposing the metrics gathered by the given registry.
+func Handler(gatherer prometheus.Gatherer) http.Handler {
+	return promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{})
+}
+
+// JobEnqueued is called after a job has been pushed to the queue.
+func (m *Metrics) JobEnqueued(queue, class string) {
+	m.enqueued.WithLabelValues(queue, class).Inc()
+}
+
+// JobStarted is called when a worker starts a job.
+func (m *Metrics) JobStarted(queue, _ string, wait time.Duration) {
+	m.inFlight.WithLabelValues(queue).Inc()
+
+	if wait > 0 {
+		m.wait.WithLabelValues(queue).Observe(wait.Seconds())
+	}
+}
+
+// JobFinished is called when a worker finishes a job with the given outcome.
+func (m *Metrics) JobFinished(queue, class, outcome string, duration time.Duration) {
+	m.inFlight.WithLabelValues(queue).Dec()
+	m.processed.WithLabelValues(queue, class, outcome).Inc()
+	m.duration.WithLabelValues(queue, class).Observe(duration.Seconds())
+}
+
+// PollError is called when the poller fails to fetch a job.
+func (m *Metrics) PollError() {
+	m.pollErrors.Inc()
+}
+
+// Describe implements prometheus.Collector.
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	m.enqueued.Describe(ch)
+	m.processed.Describe(ch)
+	m.duration.Describe(ch)
+	m.wait.Describe(ch)
+	m.inFlight.Describe(ch)
+	m.pollErrors.Describe(ch)
+	ch <- m.depthDesc
+	ch <- m.poolDesc
+}
+
+// Collect implements prometheus.Collector.
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	m.enqueued.Collect(ch)
+	m.processed.Collect(ch)
+	m.duration.Collect(ch)
+	m.wait.Collect(ch)
+	m.inFlight.Collect(ch)
+	m.pollErrors.Collect(ch)
+
+	m.collectDepths(ch)
+	m.collectPool(ch)
+}
+
+func (m *Metrics) collectDepths(ch chan<- prometheus.Metric) {
+	depths, err := m.depths()
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(m.depthDesc, err)
+		return
+	}
+
+	for queue, depth := range depths {
+		ch <- prometheus.MustNewConstMetric(m.depthDesc, prometheus.GaugeValue, float64(depth), queue)
+	}
+}
+
+func (m *Metrics) depths() (map[string]int, error) {
+	conn, err := m.pool.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	queues, err := redis.Strings(conn.Do("SMEMBERS", fmt.Sprintf("%s:queues", m.Namespace)))
+	if err != nil {
+		return nil, err
+	}
+
+	depths := make(map[string]int, len(queues))
+
+	for _, queue := range queues {
+		depth, err := redis.Int(conn.Do("LLEN", fmt.Sprintf("%s:queue:%s", m.Namespace, queue)))
+		if err != nil {
+			return nil, err
+		}
+
+		depths[queue] = depth
+	}
+
+	return depths, nil
+}
+
+func (m *Metrics) collectPool(ch chan<- prometheus.Metric) {
+	pool, ok := m.pool.(interface{ Stats() db.Stats })
+	if !ok {
+		return
+	}
+
+	stats := pool.Stats()
+	ch <- prometheus.MustNewConstMetric(m.poolDesc, prometheus.GaugeValue, float64(stats.ActiveCount-stats.IdleCount), "in_use")
+	ch <- prometheus.MustNewConstMetric(m.poolDesc, prometheus.GaugeValue, float64(stats.IdleCount), "idle")
+}
@@ -0,0 +1,112 @@
+package prom_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/snobb/goresq/pkg/db"
+	"github.com/snobb/goresq/pkg/db/mock"
+	"github.com/snobb/goresq/pkg/metrics"
+	"github.com/snobb/goresq/pkg/metrics/prom"
+)
+
+func TestMetrics_Collect(t *testing.T) {
+	tests := []struct {
+		name      string
+		wantDbErr bool
+		wantErr   bool
+		want      string
+	}{
+		{
+			name: "should collect job metrics and queue depths",
+			want: `
+# HELP goresq_jobs_enqueued_total Number of jobs pushed to the queues.
+# TYPE goresq_jobs_enqueued_total counter
+goresq_jobs_enqueued_total{class="foo",queue="queue1"} 2
+# HELP goresq_jobs_in_flight Number of jobs being performed.
+# TYPE goresq_jobs_in_flight gauge
+goresq_jobs_in_flight{queue="queue1"} 0
+# HELP goresq_jobs_processed_total Number of jobs processed by the workers.
+# TYPE goresq_jobs_processed_total counter
+goresq_jobs_processed_total{class="foo",outcome="failure",queue="queue1"} 1
+goresq_jobs_processed_total{class="foo",outcome="success",queue="queue1"} 1
+# HELP goresq_poll_errors_total Number of failed attempts to fetch a job.
+# TYPE goresq_poll_errors_total counter
+goresq_poll_errors_total 1
+# HELP goresq_queue_depth Number of jobs waiting in the queue.
+# TYPE goresq_queue_depth gauge
+goresq_queue_depth{queue="queue1"} 5
+goresq_queue_depth{queue="queue2"} 5
+`,
+		},
+		{
+			name:      "should fail to collect queue depths if redis is not available",
+			wantDbErr: true,
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockedConn := &mock.ConnMock{
+				CloseFunc: func() error {
+					return nil
+				},
+				DoFunc: func(commandName string, args ...interface{}) (interface{}, error) {
+					switch fmt.Sprintf("%s %s", commandName, args[0]) {
+					case "SMEMBERS resque:queues":
+						return []interface{}{[]byte("queue1"), []byte("queue2")}, nil
+					case "LLEN resque:queue:queue1", "LLEN resque:queue:queue2":
+						return int64(5), nil
+					}
+
+					return nil, fmt.Errorf("unexpected command %s", commandName)
+				},
+			}
+
+			mockedPool := &mock.PoolerMock{
+				ConnFunc: func() (db.Conn, error) {
+					if tt.wantDbErr {
+						return nil, fmt.Errorf("db spanner")
+					}
+					return mockedConn, nil
+				},
+			}
+
+			m := prom.New(mockedPool)
+
+			m.JobEnqueued("queue1", "foo")
+			m.JobEnqueued("queue1", "foo")
+			m.JobStarted("queue1", "foo", time.Second)
+			m.JobFinished("queue1", "foo", metrics.OutcomeSuccess, time.Second)
+			m.JobStarted("queue1", "foo", 0)
+			m.JobFinished("queue1", "foo", metrics.OutcomeFailure, time.Second)
+			m.PollError()
+
+			reg := prometheus.NewPedanticRegistry()
+			if err := m.Register(reg); err != nil {
+				t.Fatalf("Metrics.Register() error = %v", err)
+			}
+
+			err := testutil.GatherAndCompare(reg, strings.NewReader(tt.want),
+				"goresq_jobs_enqueued_total", "goresq_jobs_in_flight", "goresq_jobs_processed_total",
+				"goresq_poll_errors_total", "goresq_queue_depth")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Metrics.Collect() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			if n := testutil.CollectAndCount(m, "goresq_job_wait_seconds"); n != 1 {
+				t.Errorf("expected a single wait time series, got %d", n)
+			}
+		})
+	}
+}
@@ -0,0 +1,11 @@
+package noderesque
+
+import "time"
+
+// SetNow replaces the clock of the scheduler.
+func SetNow(s *Scheduler, fn func() time.Time) {
+	s.now = fn
+}
+
+// ReleaseSrc is the source of the script releasing the leader lock.
+const ReleaseSrc = releaseSrc
@@ -0,0 +1,49 @@
+package noderesque
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/snobb/goresq/pkg/db"
+)
+
+// Ping is the liveness record node-resque workers write to <ns>:worker:ping:<name>.
+type Ping struct {
+	Time   int64  `json:"time"`
+	Name   string `json:"name"`
+	Queues string `json:"queues"`
+}
+
+// PingKey returns the key of the ping of the worker.
+func PingKey(ns, name string) string {
+	return fmt.Sprintf("%s:worker:ping:%s", ns, name)
+}
+
+// JobKey returns the key node-resque keeps the job the worker is performing under.
+func JobKey(ns, name string) string {
+	return fmt.Sprintf("%s:worker:%s", ns, name)
+}
+
+// SendPing sends the ping of the worker serving the queues. The command is sent without
+// flushing the connection.
+func SendPing(conn db.Conn, ns, name string, queues []string, now time.Time) error {
+	buf, err := json.Marshal(Ping{Time: now.Unix(), Name: name, Queues: strings.Join(queues, ",")})
+	if err != nil {
+		return err
+	}
+
+	return conn.Send("SET", PingKey(ns, name), buf)
+}
+
+// WorkerName returns the name node-resque uses for the worker registered in the <ns>:workers
+// set, i.e. the id without the queues.
+func WorkerName(id string) string {
+	parts := strings.SplitN(id, ":", 3)
+	if len(parts) < 3 {
+		return parts[0]
+	}
+
+	return parts[0] + ":" + parts[1]
+}
@@ -0,0 +1,395 @@
+package noderesque
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+
+	"github.com/snobb/goresq/pkg/db"
+	"github.com/snobb/goresq/pkg/failure"
+	"github.com/snobb/goresq/pkg/job"
+	"github.com/snobb/goresq/pkg/logger"
+	"github.com/snobb/goresq/pkg/stats"
+)
+
+// LeaderLockKey is the key of the lock held by the node-resque scheduler leader.
+const LeaderLockKey = "resque_scheduler_leader_lock"
+
+// The defaults used by node-resque.
+const (
+	DefaultInterval           = 5 * time.Second
+	DefaultLeaderLockTimeout  = 3 * time.Minute
+	DefaultStuckWorkerTimeout = time.Hour
+)
+
+// StuckWorkerException is the exception of the failures of the jobs held by the stuck workers.
+const StuckWorkerException = "Worker Timeout (killed manually)"
+
+// scanCount is the number of keys hinted to SCAN per iteration.
+const scanCount = 1000
+
+// releaseSrc deletes the leader lock only if it is still held by the scheduler.
+const releaseSrc = `if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`
+
+var releaseScript = redis.NewScript(1, releaseSrc)
+
+// Scheduler takes part in the node-resque leader election. The leader cleans up the workers
+// whose pings are older than the stuck worker timeout, whether they are goresq or node-resque
+// workers.
+type Scheduler struct {
+	Namespace          string
+	Name               string
+	LeaderLockTimeout  time.Duration
+	StuckWorkerTimeout time.Duration
+	pool               db.Pooler
+	logger             logger.Logger
+	errors             func(error)
+	failures           failure.Backend
+	now                func() time.Time
+}
+
+// Option configures a Scheduler.
+type Option func(*Scheduler)
+
+// WithLogger sets the logger receiving the leadership and cleanup events.
+func WithLogger(log logger.Logger) Option {
+	return func(s *Scheduler) {
+		s.logger = log
+	}
+}
+
+// WithErrorHandler sets the function receiving the errors of the scheduler started with Start.
+// By default the errors are only logged.
+func WithErrorHandler(fn func(error)) Option {
+	return func(s *Scheduler) {
+		s.errors = fn
+	}
+}
+
+// WithFailureBackend sets the backend storing the jobs of the stuck workers. The failed list of
+// the namespace is used by default.
+func WithFailureBackend(backend failure.Backend) Option {
+	return func(s *Scheduler) {
+		s.failures = backend
+	}
+}
+
+// NewScheduler creates a new scheduler named after the host and the process.
+func NewScheduler(pool db.Pooler, opts ...Option) *Scheduler {
+	hostname, err := os.Hostname()
+	if err != nil {
+		panic(err)
+	}
+
+	s := &Scheduler{
+		Namespace:          "resque",
+		Name:               fmt.Sprintf("%s:%d", hostname, os.Getpid()),
+		LeaderLockTimeout:  DefaultLeaderLockTimeout,
+		StuckWorkerTimeout: DefaultStuckWorkerTimeout,
+		pool:               pool,
+		logger:             logger.Nop{},
+		errors:             func(error) {},
+		now:                time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// Start polls every interval until the context is done and then releases the leadership.
+func (s *Scheduler) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Poll(); err != nil {
+			s.logger.Error("scheduler poll failed", logger.F("scheduler", s.Name), logger.F(logger.KeyError, err))
+			s.errors(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			if err := s.Release(); err != nil {
+				s.errors(err)
+			}
+
+			return
+
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll tries to become or stay the leader and cleans up the stuck workers if it is.
+func (s *Scheduler) Poll() error {
+	leader, err := s.TryForLeader()
+	if err != nil || !leader {
+		return err
+	}
+
+	_, err = s.CleanStuckWorkers()
+
+	return err
+}
+
+func (s *Scheduler) key() string {
+	return fmt.Sprintf("%s:%s", s.Namespace, LeaderLockKey)
+}
+
+// TryForLeader acquires the leader lock if nobody holds it or extends it if the scheduler
+// already holds it, and reports whether the scheduler is the leader.
+func (s *Scheduler) TryForLeader() (bool, error) {
+	conn, err := s.pool.Conn()
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	timeout := int(s.LeaderLockTimeout / time.Second)
+
+	res, err := conn.Do("SET", s.key(), s.Name, "NX", "EX", timeout)
+	if err != nil {
+		return false, err
+	}
+
+	if res != nil {
+		s.logger.Info("scheduler became leader", logger.F("scheduler", s.Name))
+		return true, nil
+	}
+
+	leader, err := redis.String(conn.Do("GET", s.key()))
+	if err != nil && !errors.Is(err, redis.ErrNil) {
+		return false, err
+	}
+
+	if leader != s.Name {
+		return false, nil
+	}
+
+	if _, err := conn.Do("EXPIRE", s.key(), timeout); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Release releases the leader lock if the scheduler holds it.
+func (s *Scheduler) Release() error {
+	conn, err := s.pool.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// the lock is compared and deleted atomically so that a lock taken over by another
+	// scheduler in between is left alone.
+	released, err := redis.Int(releaseScript.Do(conn, s.key(), s.Name))
+	if err != nil {
+		return err
+	}
+
+	if released > 0 {
+		s.logger.Info("scheduler released leadership", logger.F("scheduler", s.Name))
+	}
+
+	return nil
+}
+
+// CleanStuckWorkers unregisters the workers whose pings are older than the stuck worker timeout
+// and returns their names. The jobs they were performing are moved to the failed list.
+func (s *Scheduler) CleanStuckWorkers() ([]string, error) {
+	conn, err := s.pool.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	keys, err := s.pingKeys(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	cleaned := []string{}
+
+	for _, key := range keys {
+		buf, err := redis.Bytes(conn.Do("GET", key))
+		if errors.Is(err, redis.ErrNil) {
+			continue
+		} else if err != nil {
+			return cleaned, err
+		}
+
+		var ping Ping
+		if err := json.Unmarshal(buf, &ping); err != nil {
+			s.logger.Error("invalid worker ping", logger.F("key", key), logger.F(logger.KeyError, err))
+			continue
+		}
+
+		if s.now().Sub(time.Unix(ping.Time, 0)) <= s.StuckWorkerTimeout {
+			continue
+		}
+
+		if err := s.cleanWorker(conn, ping.Name); err != nil {
+			return cleaned, err
+		}
+
+		s.logger.Info("stuck worker cleaned", logger.F(logger.KeyWorker, ping.Name),
+			logger.F("ping", time.Unix(ping.Time, 0).UTC()))
+
+		cleaned = append(cleaned, ping.Name)
+	}
+
+	return cleaned, nil
+}
+
+// pingKeys returns the keys of the worker pings. The keys are scanned rather than listed with
+// KEYS so that redis is not blocked on a large keyspace; a key may be returned more than once.
+func (s *Scheduler) pingKeys(conn db.Conn) ([]string, error) {
+	var keys []string
+
+	for cursor := 0; ; {
+		values, err := redis.Values(conn.Do("SCAN", cursor, "MATCH", PingKey(s.Namespace, "*"), "COUNT", scanCount))
+		if err != nil {
+			return nil, err
+		}
+
+		var page []string
+		if _, err := redis.Scan(values, &cursor, &page); err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, page...)
+
+		if cursor == 0 {
+			return keys, nil
+		}
+	}
+}
+
+// cleanWorker removes all the keys of the worker the way node-resque forceCleanWorker does.
+func (s *Scheduler) cleanWorker(conn db.Conn, name string) error {
+	ids, err := redis.Strings(conn.Do("SMEMBERS", fmt.Sprintf("%s:workers", s.Namespace)))
+	if err != nil {
+		return err
+	}
+
+	var (
+		workers  []string
+		failures []*failure.Failure
+	)
+
+	// the current jobs are read before anything is sent so that no reply is left pending.
+	for _, id := range ids {
+		if WorkerName(id) != name {
+			continue
+		}
+
+		workers = append(workers, id)
+
+		f, err := s.stuckJob(conn, fmt.Sprintf("%s:worker:%s", s.Namespace, id), id)
+		if err != nil {
+			return err
+		}
+
+		if f != nil {
+			failures = append(failures, f)
+		}
+	}
+
+	// node-resque keeps the job of the worker under its name. goresq mirrors its job there
+	// WithNodeResque, so the name is only read when no job was found under the worker ids.
+	if len(failures) == 0 {
+		f, err := s.stuckJob(conn, JobKey(s.Namespace, name), name)
+		if err != nil {
+			return err
+		}
+
+		if f != nil {
+			failures = append(failures, f)
+		}
+	}
+
+	store := s.failures
+	if store == nil {
+		store = &failure.Redis{Namespace: s.Namespace}
+	}
+
+	for _, f := range failures {
+		if err := store.Save(conn, f); err != nil {
+			return err
+		}
+	}
+
+	var cmds [][]interface{}
+
+	for _, id := range workers {
+		cmds = append(cmds,
+			[]interface{}{"SREM", fmt.Sprintf("%s:workers", s.Namespace), id},
+			[]interface{}{"HDEL", fmt.Sprintf("%s:workers:heartbeat", s.Namespace), id},
+			[]interface{}{"DEL", fmt.Sprintf("%s:worker:%s", s.Namespace, id)},
+			[]interface{}{"DEL", fmt.Sprintf("%s:worker:%s:started", s.Namespace, id)},
+		)
+
+		for _, stat := range stats.Names() {
+			cmds = append(cmds, []interface{}{"DEL", stats.WorkerKey(s.Namespace, id, stat)})
+		}
+	}
+
+	// node-resque keeps the statistics and the job of the worker under its name.
+	for _, stat := range stats.Names() {
+		cmds = append(cmds, []interface{}{"DEL", stats.WorkerKey(s.Namespace, name, stat)})
+	}
+
+	cmds = append(cmds,
+		[]interface{}{"DEL", JobKey(s.Namespace, name)},
+		[]interface{}{"DEL", JobKey(s.Namespace, name) + ":started"},
+		[]interface{}{"DEL", PingKey(s.Namespace, name)},
+	)
+
+	for _, cmd := range cmds {
+		if err := conn.Send(cmd[0].(string), cmd[1:]...); err != nil {
+			return err
+		}
+	}
+
+	_, err = conn.Do("")
+
+	return err
+}
+
+// stuckJob returns the failure of the job recorded under the key, nil if there is none.
+func (s *Scheduler) stuckJob(conn db.Conn, key, worker string) (*failure.Failure, error) {
+	buf, err := redis.Bytes(conn.Do("GET", key))
+	if errors.Is(err, redis.ErrNil) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var working struct {
+		Queue   string      `json:"queue"`
+		Payload job.Payload `json:"payload"`
+	}
+
+	if err := json.Unmarshal(buf, &working); err != nil {
+		s.logger.Error("invalid worker job", logger.F(logger.KeyWorker, worker), logger.F(logger.KeyError, err))
+		return nil, nil
+	}
+
+	f := failure.New(&job.Job{Queue: working.Queue, Payload: working.Payload}, worker,
+		errors.New(StuckWorkerException))
+	f.Exception = StuckWorkerException
+
+	return f, nil
+}
@@ -0,0 +1,210 @@
+package noderesque_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+
+	"github.com/snobb/goresq/pkg/db"
+	"github.com/snobb/goresq/pkg/db/mock"
+	"github.com/snobb/goresq/pkg/failure"
+	"github.com/snobb/goresq/pkg/noderesque"
+
+	"github.com/snobb/goresq/test/assert"
+	"github.com/snobb/goresq/test/fakeredis"
+)
+
+// newRedis returns an in-memory redis running the scripts of the scheduler.
+func newRedis() *fakeredis.Redis {
+	rds := fakeredis.New()
+	rds.RegisterScript(noderesque.ReleaseSrc, func(call func(string, ...interface{}) (interface{}, error),
+		keys, args []string,
+	) (interface{}, error) {
+		leader, err := redis.String(call("GET", keys[0]))
+		if err != nil && !errors.Is(err, redis.ErrNil) {
+			return nil, err
+		}
+
+		if leader != args[0] {
+			return int64(0), nil
+		}
+
+		return call("DEL", keys[0])
+	})
+
+	return rds
+}
+
+func TestScheduler_TryForLeader(t *testing.T) {
+	tests := []struct {
+		name       string
+		lock       string
+		wantLeader bool
+		wantLock   string
+	}{
+		{
+			name:       "acquire the free lock",
+			wantLeader: true,
+			wantLock:   "me",
+		},
+		{
+			name:       "keep the own lock",
+			lock:       "me",
+			wantLeader: true,
+			wantLock:   "me",
+		},
+		{
+			name:       "respect the lock of another scheduler",
+			lock:       "node-resque",
+			wantLeader: false,
+			wantLock:   "node-resque",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rds := newRedis()
+			if tt.lock != "" {
+				_, _ = rds.Do("SET", "resque:resque_scheduler_leader_lock", tt.lock)
+			}
+
+			s := noderesque.NewScheduler(rds.Pool())
+			s.Name = "me"
+
+			leader, err := s.TryForLeader()
+			assert.Eq(t, nil, err)
+			assert.Eq(t, tt.wantLeader, leader)
+
+			lock, _ := rds.Get("resque:resque_scheduler_leader_lock")
+			assert.Eq(t, tt.wantLock, lock)
+
+			assert.Eq(t, nil, s.Release())
+
+			_, held := rds.Get("resque:resque_scheduler_leader_lock")
+			assert.Eq(t, !tt.wantLeader, held)
+		})
+	}
+}
+
+func TestScheduler_ReleaseError(t *testing.T) {
+	pool := &mock.PoolerMock{
+		ConnFunc: func() (db.Conn, error) {
+			return &mock.ConnMock{
+				CloseFunc: func() error { return nil },
+				DoFunc: func(commandName string, args ...interface{}) (interface{}, error) {
+					return nil, fmt.Errorf("spanner")
+				},
+			}, nil
+		},
+	}
+
+	s := noderesque.NewScheduler(pool)
+
+	assert.Eq(t, true, s.Release() != nil)
+}
+
+func TestScheduler_CleanStuckWorkers(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	ping := func(name string, age time.Duration) string {
+		buf, _ := json.Marshal(noderesque.Ping{Time: now.Add(-age).Unix(), Name: name, Queues: "mail"})
+		return string(buf)
+	}
+
+	rds := fakeredis.New()
+	rds.Seed(t, [][]interface{}{
+		// a stuck goresq worker performing a job.
+		{"SADD", "resque:workers", "host:1-worker0:mail"},
+		{"SET", "resque:worker:host:1-worker0:mail", `{"queue":"mail","run_at":"x","payload":{"class":"Mail","args":[1]}}`},
+		{"SET", "resque:worker:host:1-worker0:mail:started", "1"},
+		{"SET", "resque:stat:processed:host:1-worker0:mail", "3"},
+		{"HSET", "resque:workers:heartbeat", "host:1-worker0:mail", "x"},
+		{"SET", "resque:worker:ping:host:1-worker0", ping("host:1-worker0", 2*time.Hour)},
+		// a stuck idle node-resque worker.
+		{"SADD", "resque:workers", "node:2:mail"},
+		{"SET", "resque:stat:processed:node:2", "5"},
+		{"SET", "resque:worker:ping:node:2", ping("node:2", 90*time.Minute)},
+		// a stuck node-resque worker performing a job, recorded under its name.
+		{"SADD", "resque:workers", "node:3:sms"},
+		{"SET", "resque:worker:node:3", `{"queue":"sms","run_at":"x","payload":{"class":"Sms","args":[2]}}`},
+		{"SET", "resque:worker:node:3:started", "1"},
+		{"SET", "resque:worker:ping:node:3", ping("node:3", 90*time.Minute)},
+		// a live worker.
+		{"SADD", "resque:workers", "host:1-worker1:mail"},
+		{"SET", "resque:worker:ping:host:1-worker1", ping("host:1-worker1", time.Minute)},
+	}...)
+
+	s := noderesque.NewScheduler(rds.Pool())
+	noderesque.SetNow(s, func() time.Time { return now })
+
+	cleaned, err := s.CleanStuckWorkers()
+	assert.Eq(t, nil, err)
+	assert.Eq(t, "host:1-worker0 node:2 node:3", strings.Join(cleaned, " "))
+
+	assert.Eq(t, "host:1-worker1:mail", strings.Join(rds.Members("resque:workers"), " "))
+	assert.Eq(t, "resque:worker:ping:host:1-worker1", strings.Join(rds.Keys("resque:worker:*"), " "))
+	assert.Eq(t, 0, len(rds.Keys("resque:stat:*")))
+
+	failed := rds.List("resque:failed")
+	assert.Eq(t, 2, len(failed))
+
+	tests := []struct {
+		worker string
+		queue  string
+		class  string
+	}{
+		{"host:1-worker0:mail", "mail", "Mail"},
+		{"node:3", "sms", "Sms"},
+	}
+
+	for i, tt := range tests {
+		var f failure.Failure
+		assert.Eq(t, nil, json.Unmarshal([]byte(failed[i]), &f))
+		assert.Eq(t, noderesque.StuckWorkerException, f.Exception)
+		assert.Eq(t, tt.worker, f.Worker)
+		assert.Eq(t, tt.queue, f.Queue)
+		assert.Eq(t, tt.class, f.Payload.Class)
+	}
+}
+
+func TestScheduler_CleanStuckWorkersFailureBackend(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	buf, _ := json.Marshal(noderesque.Ping{Time: now.Add(-2 * time.Hour).Unix(), Name: "host:1-worker0", Queues: "mail"})
+
+	rds := fakeredis.New()
+	rds.Seed(t, [][]interface{}{
+		{"SADD", "resque:workers", "host:1-worker0:mail"},
+		{"SET", "resque:worker:host:1-worker0:mail", `{"queue":"mail","run_at":"x","payload":{"class":"Mail","args":[1]}}`},
+		{"SET", "resque:worker:ping:host:1-worker0", string(buf)},
+	}...)
+
+	s := noderesque.NewScheduler(rds.Pool(), noderesque.WithFailureBackend(failure.NewPerQueue("resque")))
+	noderesque.SetNow(s, func() time.Time { return now })
+
+	cleaned, err := s.CleanStuckWorkers()
+	assert.Eq(t, nil, err)
+	assert.Eq(t, "host:1-worker0", strings.Join(cleaned, " "))
+	assert.Eq(t, 0, len(rds.List("resque:failed")))
+	assert.Eq(t, 1, len(rds.List("resque:mail_failed")))
+}
+
+func TestWorkerName(t *testing.T) {
+	tests := []struct {
+		id   string
+		want string
+	}{
+		{id: "host:1-worker0:mail,low", want: "host:1-worker0"},
+		{id: "host:1:a:b", want: "host:1"},
+		{id: "host", want: "host"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			assert.Eq(t, tt.want, noderesque.WorkerName(tt.id))
+		})
+	}
+}
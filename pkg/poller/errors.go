@@ -0,0 +1,88 @@
+package poller
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrDecode is reported when a job payload fetched from the queue can not be decoded.
+	ErrDecode = errors.New("could not decode job payload")
+
+	// ErrRedis is reported when a redis command fails.
+	ErrRedis = errors.New("redis failure")
+
+	// ErrHook is returned when a lifecycle hook fails.
+	ErrHook = errors.New("lifecycle hook failed")
+
+	// ErrStopped is returned when the concurrency of a poller is changed after it stopped.
+	ErrStopped = errors.New("poller stopped")
+)
+
+// Error is an error reported by the poller and the workers. It wraps one of ErrDecode,
+// ErrRedis, ErrHook, job.ErrNoHandler, job.ErrPlugin or the error returned by the job handler.
+type Error struct {
+	Queue  string
+	Class  string
+	Worker string
+	Err    error
+}
+
+// Error returns the error message with the context the error happened in.
+func (e *Error) Error() string {
+	var sb strings.Builder
+
+	for _, f := range []struct{ key, value string }{
+		{"worker", e.Worker},
+		{"queue", e.Queue},
+		{"class", e.Class},
+	} {
+		if f.value != "" {
+			fmt.Fprintf(&sb, "%s %s: ", f.key, f.value)
+		}
+	}
+
+	sb.WriteString(e.Err.Error())
+
+	return sb.String()
+}
+
+// Unwrap returns the wrapped error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func redisError(err error) error {
+	return fmt.Errorf("%w: %w", ErrRedis, err)
+}
+
+// ErrorHandler handles the errors reported by the poller and the workers. It is called
+// synchronously and must not block.
+type ErrorHandler interface {
+	HandleError(err error)
+}
+
+// ErrorHandlerFunc is a function handling the errors reported by the poller and the workers.
+type ErrorHandlerFunc func(err error)
+
+// HandleError calls the function with the error.
+func (f ErrorHandlerFunc) HandleError(err error) {
+	f(err)
+}
+
+// ErrorChan returns an error handler sending the errors to the channel. The errors are dropped
+// if the channel is not ready to receive them.
+func ErrorChan(errs chan<- error) ErrorHandler {
+	return ErrorHandlerFunc(func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+	})
+}
+
+type nopErrorHandler struct{}
+
+// HandleError discards the error.
+func (nopErrorHandler) HandleError(_ error) {}
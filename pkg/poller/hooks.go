@@ -0,0 +1,116 @@
+package poller
+
+import (
+	"context"
+	"fmt"
+)
+
+// PollerHook is called when the poller starts. An error stops the poller before any worker is
+// started.
+type PollerHook func(ctx context.Context) error
+
+// PollerStopHook is called once all the workers of the poller have stopped.
+type PollerStopHook func(ctx context.Context)
+
+// WorkerHook is called when a worker starts, after it has been registered. The returned context
+// is the context the jobs of the worker are performed with, so that the hook can attach per-worker
+// resources to it. An error stops the worker before it takes any job.
+type WorkerHook func(ctx context.Context, w *Worker) (context.Context, error)
+
+// WorkerStopHook is called when a worker stops, with the context returned by the WorkerHooks,
+// before the worker is unregistered.
+type WorkerStopHook func(ctx context.Context, w *Worker)
+
+// IdleHook is called with the context of the worker when a poll finds no job.
+type IdleHook func(ctx context.Context, w *Worker)
+
+type hooks struct {
+	pollerStart []PollerHook
+	pollerStop  []PollerStopHook
+	workerStart []WorkerHook
+	workerStop  []WorkerStopHook
+	idle        []IdleHook
+}
+
+// OnPollerStart registers a hook called when the poller starts. The hooks are called in the
+// order of the registration.
+func OnPollerStart(hook PollerHook) Option {
+	return func(o *options) {
+		o.hooks.pollerStart = append(o.hooks.pollerStart, hook)
+	}
+}
+
+// OnPollerStop registers a hook called when the poller stops. The hooks are called in the
+// reverse order of the registration.
+func OnPollerStop(hook PollerStopHook) Option {
+	return func(o *options) {
+		o.hooks.pollerStop = append(o.hooks.pollerStop, hook)
+	}
+}
+
+// OnWorkerStart registers a hook called when a worker starts. The hooks are called in the order
+// of the registration, each with the context returned by the previous one.
+func OnWorkerStart(hook WorkerHook) Option {
+	return func(o *options) {
+		o.hooks.workerStart = append(o.hooks.workerStart, hook)
+	}
+}
+
+// OnWorkerStop registers a hook called when a worker stops. The hooks are called in the reverse
+// order of the registration.
+func OnWorkerStop(hook WorkerStopHook) Option {
+	return func(o *options) {
+		o.hooks.workerStop = append(o.hooks.workerStop, hook)
+	}
+}
+
+// OnIdle registers a hook called when a poll finds no job, by the worker the empty poll has
+// been handed to.
+func OnIdle(hook IdleHook) Option {
+	return func(o *options) {
+		o.hooks.idle = append(o.hooks.idle, hook)
+	}
+}
+
+func (h *hooks) startPoller(ctx context.Context) error {
+	for _, hook := range h.pollerStart {
+		if err := hook(ctx); err != nil {
+			return fmt.Errorf("%w: %w", ErrHook, err)
+		}
+	}
+
+	return nil
+}
+
+func (h *hooks) stopPoller(ctx context.Context) {
+	for i := len(h.pollerStop) - 1; i >= 0; i-- {
+		h.pollerStop[i](context.WithoutCancel(ctx))
+	}
+}
+
+func (h *hooks) startWorker(ctx context.Context, w *Worker) (context.Context, error) {
+	for _, hook := range h.workerStart {
+		next, err := hook(ctx, w)
+		if err != nil {
+			return ctx, fmt.Errorf("%w: %w", ErrHook, err)
+		}
+
+		if next != nil {
+			ctx = next
+		}
+	}
+
+	return ctx, nil
+}
+
+func (h *hooks) stopWorker(ctx context.Context, w *Worker) {
+	for i := len(h.workerStop) - 1; i >= 0; i-- {
+		h.workerStop[i](context.WithoutCancel(ctx), w)
+	}
+}
+
+func (h *hooks) idleWorker(ctx context.Context, w *Worker) {
+	for _, hook := range h.idle {
+		hook(ctx, w)
+	}
+}
@@ -0,0 +1,118 @@
+package poller_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/snobb/goresq/pkg/job"
+	"github.com/snobb/goresq/pkg/poller"
+
+	"github.com/snobb/goresq/test/assert"
+	"github.com/snobb/goresq/test/fakeredis"
+)
+
+type resourceKey struct{}
+
+func TestPoller_StartHooks(t *testing.T) {
+	errSpanner := errors.New("spanner")
+
+	tests := []struct {
+		name        string
+		pollerErr   error
+		workerErr   error
+		wantErrIs   error
+		wantEvents  string
+		wantPerform bool
+	}{
+		{
+			name:        "hooks around the job",
+			wantEvents:  "poller start,worker start,perform,idle,worker stop,poller stop",
+			wantPerform: true,
+		},
+		{
+			name:       "failing poller start hook",
+			pollerErr:  errSpanner,
+			wantErrIs:  poller.ErrHook,
+			wantEvents: "poller start",
+		},
+		{
+			name:       "failing worker start hook",
+			workerErr:  errSpanner,
+			wantErrIs:  poller.ErrHook,
+			wantEvents: "poller start,worker start,poller stop",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rds := fakeredis.New()
+			_, _ = rds.Do("RPUSH", "resque:queue:queue1", `{"class":"foo","args":[]}`)
+
+			var (
+				mu     sync.Mutex
+				events []string
+			)
+
+			event := func(name string) {
+				mu.Lock()
+				defer mu.Unlock()
+
+				// the idle polls are recorded once.
+				if len(events) == 0 || events[len(events)-1] != name {
+					events = append(events, name)
+				}
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+
+			handlers := map[string]job.Handler{
+				"foo": job.PerformFunc(func(ctx context.Context, queue, class string, args []json.RawMessage) (job.Result, error) {
+					assert.Eq(t, "resource", ctx.Value(resourceKey{}))
+					event("perform")
+
+					return nil, nil
+				}),
+			}
+
+			p := poller.New(rds.Pool(), time.Millisecond, 1,
+				poller.OnPollerStart(func(ctx context.Context) error {
+					event("poller start")
+					return tt.pollerErr
+				}),
+				poller.OnWorkerStart(func(ctx context.Context, w *poller.Worker) (context.Context, error) {
+					event("worker start")
+					return context.WithValue(ctx, resourceKey{}, "resource"), tt.workerErr
+				}),
+				poller.OnIdle(func(ctx context.Context, w *poller.Worker) {
+					assert.Eq(t, "resource", ctx.Value(resourceKey{}))
+					event("idle")
+				}),
+				poller.OnWorkerStop(func(ctx context.Context, w *poller.Worker) {
+					assert.Eq(t, "resource", ctx.Value(resourceKey{}))
+					assert.Eq(t, nil, ctx.Err())
+					assert.Eq(t, true, strings.HasSuffix(w.String(), "-worker0:queue1"))
+					event("worker stop")
+				}),
+				poller.OnPollerStop(func(ctx context.Context) {
+					event("poller stop")
+				}),
+			)
+
+			err := p.Start(ctx, []string{"queue1"}, handlers)
+			assert.Eq(t, true, errors.Is(err, tt.wantErrIs))
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			assert.Eq(t, tt.wantEvents, strings.Join(events, ","))
+			assert.Eq(t, !tt.wantPerform, len(rds.List("resque:queue:queue1")) == 1)
+			assert.Eq(t, 0, len(rds.Members("resque:workers")))
+		})
+	}
+}
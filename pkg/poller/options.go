@@ -0,0 +1,131 @@
+package poller
+
+import (
+	"time"
+
+	"github.com/snobb/goresq/pkg/failure"
+	"github.com/snobb/goresq/pkg/logger"
+	"github.com/snobb/goresq/pkg/metrics"
+	"github.com/snobb/goresq/pkg/trace"
+)
+
+// Option configures a Poller and its workers.
+type Option func(*options)
+
+type options struct {
+	recorder          metrics.Recorder
+	tracer            trace.Tracer
+	logger            logger.Logger
+	errors            ErrorHandler
+	heartbeatInterval time.Duration
+	nodeResque        bool
+	queueRefresh      time.Duration
+	strategy          Strategy
+	autoscale         *Autoscale
+	hooks             hooks
+	failures          failure.Backend
+}
+
+// DefaultHeartbeat is the default interval between the worker heartbeats.
+const DefaultHeartbeat = 60 * time.Second
+
+func newOptions(opts []Option) options {
+	o := options{
+		recorder:          metrics.Nop{},
+		logger:            logger.Nop{},
+		errors:            nopErrorHandler{},
+		heartbeatInterval: DefaultHeartbeat,
+		queueRefresh:      DefaultQueueRefresh,
+		strategy:          Strict(),
+	}
+
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return o
+}
+
+// WithRecorder sets the recorder receiving the poller and worker metrics.
+func WithRecorder(recorder metrics.Recorder) Option {
+	return func(o *options) {
+		o.recorder = recorder
+	}
+}
+
+// WithTracer sets the tracer used by the workers. The trace context injected by the queue is
+// extracted from the job payload and the job is performed in a child span.
+func WithTracer(tracer trace.Tracer) Option {
+	return func(o *options) {
+		o.tracer = tracer
+	}
+}
+
+// WithLogger sets the logger receiving the poller and worker lifecycle events.
+func WithLogger(log logger.Logger) Option {
+	return func(o *options) {
+		o.logger = log
+	}
+}
+
+// WithErrorHandler sets the handler receiving the errors reported by the poller and the workers.
+// By default the errors are discarded. The errors of the worker registration, heartbeats and
+// job tracking are also logged with the logger set with WithLogger.
+func WithErrorHandler(handler ErrorHandler) Option {
+	return func(o *options) {
+		o.errors = handler
+	}
+}
+
+// WithHeartbeat sets the interval between the worker heartbeats written to the
+// <ns>:workers:heartbeat hash. Non-positive intervals are ignored.
+func WithHeartbeat(interval time.Duration) Option {
+	return func(o *options) {
+		if interval > 0 {
+			o.heartbeatInterval = interval
+		}
+	}
+}
+
+// WithQueueRefresh sets the interval between the resolutions of the queue patterns against the
+// <ns>:queues set. Non-positive intervals are ignored.
+func WithQueueRefresh(interval time.Duration) Option {
+	return func(o *options) {
+		if interval > 0 {
+			o.queueRefresh = interval
+		}
+	}
+}
+
+// WithStrategy sets the strategy ordering the queues on each poll. By default the queues are
+// polled in strict priority order.
+func WithStrategy(strategy Strategy) Option {
+	return func(o *options) {
+		o.strategy = strategy
+	}
+}
+
+// WithAutoscale enables the autoscaler of the poller workers, or of every pool without an
+// autoscaler of its own.
+func WithAutoscale(scale Autoscale) Option {
+	return func(o *options) {
+		o.autoscale = &scale
+	}
+}
+
+// WithFailureBackend sets the backend the failed jobs are saved to. By default they are pushed
+// to the <ns>:failed list, the only list the admin, the dashboard and the command line read.
+func WithFailureBackend(backend failure.Backend) Option {
+	return func(o *options) {
+		o.failures = backend
+	}
+}
+
+// WithNodeResque makes the workers write node-resque pings along with their heartbeats and the
+// poller take part in the node-resque scheduler leader election, so that goresq and node-resque
+// workers sharing the namespace clean up each other's stuck workers.
+func WithNodeResque() Option {
+	return func(o *options) {
+		o.nodeResque = true
+	}
+}
@@ -6,10 +6,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/snobb/goresq/pkg/db"
 	"github.com/snobb/goresq/pkg/job"
+	"github.com/snobb/goresq/pkg/logger"
+	"github.com/snobb/goresq/pkg/noderesque"
 )
 
 // Poller represents a queue poller
@@ -18,46 +21,203 @@ type Poller struct {
 	interval  time.Duration
 	concur    int
 	pool      db.Pooler
+	opts      []Option
+	options
+
+	mu     sync.Mutex
+	ctx    context.Context
+	groups []*group
+	nextID atomic.Int64
 }
 
 // New creates a new Poller
-func New(pool db.Pooler, interval time.Duration, concur int) *Poller {
+func New(pool db.Pooler, interval time.Duration, concur int, opts ...Option) *Poller {
 	return &Poller{
 		Namespace: "resque",
 		interval:  interval,
 		concur:    concur,
 		pool:      pool,
+		opts:      opts,
+		options:   newOptions(opts),
 	}
 }
 
+// Pool is a group of workers with its own fetch loop serving a set of queues, so that the jobs
+// of the queues of one pool can not occupy the workers of another pool.
+type Pool struct {
+	// Queues are the queues or the queue patterns served by the pool.
+	Queues []string
+	// Concurrency is the number of workers of the pool.
+	Concurrency int
+	// Strategy orders the queues of the pool. It defaults to the strategy of the poller.
+	Strategy Strategy
+	// Autoscale enables the autoscaler of the pool, starting with Concurrency workers. It
+	// defaults to the autoscaler set with WithAutoscale.
+	Autoscale *Autoscale
+}
+
 // Start polling the queue. The poller is aware of context cancel and timeout and will quite on
-// these events.
-func (p *Poller) Start(ctx context.Context, queues []string, handlers map[string]job.Handler, errors chan<- error) error {
-	var wg sync.WaitGroup
+// these events. The errors are reported to the error handler set with WithErrorHandler.
+//
+// The queues may be glob patterns such as * or mail_*, resolved against the queues registered
+// in <ns>:queues and refreshed at the interval set with WithQueueRefresh.
+func (p *Poller) Start(ctx context.Context, queues []string, handlers map[string]job.Handler) error {
+	return p.StartPools(ctx, []Pool{{Queues: queues, Concurrency: p.concur}}, handlers)
+}
 
-	jobs := p.poll(ctx, queues, &wg, errors)
+// StartPools polls the queues of every pool with separate fetch loops and workers until the
+// context is done.
+func (p *Poller) StartPools(ctx context.Context, pools []Pool, handlers map[string]job.Handler) error {
+	// the defaults are applied to a copy, the pools of the caller are left untouched.
+	pools = append([]Pool(nil), pools...)
 
-	for i := 0; i < p.concur; i++ {
-		w := NewWorker(i, p.Namespace, queues, handlers, p.pool)
+	for i, pool := range pools {
+		if pool.Concurrency <= 0 {
+			return fmt.Errorf("invalid concurrency %d of the pool %v", pool.Concurrency, pool.Queues)
+		}
 
-		if err := w.Work(ctx, jobs, &wg, errors); err != nil {
-			select {
-			case <-ctx.Done():
-				break
-			default:
-				i--
+		if err := validatePatterns(pool.Queues); err != nil {
+			return err
+		}
+
+		if pool.Strategy == nil {
+			pools[i].Strategy = p.strategy
+		}
+
+		if pool.Autoscale == nil {
+			pools[i].Autoscale = p.autoscale
+		}
+
+		if a := pools[i].Autoscale; a != nil {
+			if err := a.validate(); err != nil {
+				return err
 			}
+
+			pools[i].Concurrency = min(max(pool.Concurrency, a.Min), a.Max)
+		}
+	}
+
+	if err := p.hooks.startPoller(ctx); err != nil {
+		return err
+	}
+
+	defer p.hooks.stopPoller(ctx)
+
+	var wg sync.WaitGroup
+
+	if p.nodeResque {
+		p.schedule(ctx, &wg)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	p.mu.Lock()
+	p.ctx, p.groups = ctx, nil
+
+	for _, pool := range pools {
+		p.logger.Info("poller started", logger.F(logger.KeyQueues, pool.Queues), logger.F("concurrency", pool.Concurrency))
+		defer p.logger.Info("poller stopped", logger.F(logger.KeyQueues, pool.Queues))
+
+		// the workers are started before the fetch loop so that no job is fetched for a pool
+		// without workers.
+		jobs := make(chan *job.Job)
+
+		g := &group{poller: p, pool: pool, jobs: jobs, handlers: handlers, wg: &wg}
+
+		if err := g.resize(ctx, pool.Concurrency); g.size() == 0 && ctx.Err() == nil {
+			p.groups = nil
+			p.mu.Unlock()
+			cancel()
+			wg.Wait()
+
+			return fmt.Errorf("no worker of the pool %v started: %w", pool.Queues, err)
 		}
+
+		p.poll(ctx, pool, jobs, &wg)
+
+		if pool.Autoscale != nil {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+				g.autoscale(ctx)
+			}()
+		}
+
+		p.groups = append(p.groups, g)
 	}
 
+	p.mu.Unlock()
+
 	wg.Wait()
 
+	// the stopped pools can no longer be resized.
+	p.mu.Lock()
+	p.groups = nil
+	p.mu.Unlock()
+
 	return nil
 }
 
-func (p *Poller) poll(ctx context.Context, queues []string, wg *sync.WaitGroup, errors chan<- error) <-chan *job.Job {
+// SetConcurrency changes the number of workers of the poller started with Start, or of its
+// first pool, while it is running. The workers are registered and unregistered as they are
+// started and stopped; a stopped worker finishes its current job first.
+func (p *Poller) SetConcurrency(n int) error {
+	return p.SetPoolConcurrency(0, n)
+}
+
+// SetPoolConcurrency changes the number of workers of the pool at the index of the pools the
+// poller has been started with. If a worker fails to start, the error is returned and the
+// workers started so far are kept. ErrStopped is returned once the poller has stopped.
+func (p *Poller) SetPoolConcurrency(pool, n int) error {
+	if n <= 0 {
+		return fmt.Errorf("invalid concurrency %d", n)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.ctx != nil && p.ctx.Err() != nil {
+		return ErrStopped
+	}
+
+	if len(p.groups) == 0 && pool == 0 {
+		// not started yet.
+		p.concur = n
+		return nil
+	}
+
+	if pool < 0 || pool >= len(p.groups) {
+		return fmt.Errorf("invalid pool %d", pool)
+	}
+
+	return p.groups[pool].resize(p.ctx, n)
+}
+
+// Concurrency returns the current number of workers of every pool.
+func (p *Poller) Concurrency() []int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	res := make([]int, len(p.groups))
+	for i, g := range p.groups {
+		res[i] = g.size()
+	}
+
+	return res
+}
+
+// nextWorkerID returns the id of the next worker. The worker ids are unique across the pools
+// as node-resque knows the workers by the id without the queues.
+func (p *Poller) nextWorkerID() int {
+	return int(p.nextID.Add(1) - 1)
+}
+
+func (p *Poller) poll(ctx context.Context, pool Pool, jobs chan *job.Job, wg *sync.WaitGroup) {
 	ticker := time.NewTicker(p.interval)
-	jobs := make(chan *job.Job)
+	queues := pool.Queues
+	queueSet := newResolver(p.Namespace, queues, p.queueRefresh)
 
 	wg.Add(1)
 
@@ -68,30 +228,67 @@ func (p *Poller) poll(ctx context.Context, queues []string, wg *sync.WaitGroup,
 			wg.Done()
 		}()
 
+		failing := false
+
 		for {
 			select {
 			case <-ctx.Done():
 				return
 
 			case <-ticker.C:
-				if err := p.pollTick(queues, jobs); err != nil {
-					errors <- err
+				if err := p.pollTick(queueSet, pool.Strategy, jobs); err != nil {
+					failing = true
+					p.recorder.PollError()
+					p.logger.Error("poll failed", logger.F(logger.KeyQueues, queues), logger.F(logger.KeyError, err))
+					p.errors.HandleError(err)
+				} else if failing {
+					failing = false
+					p.logger.Info("poll recovered", logger.F(logger.KeyQueues, queues))
 				}
 			}
 		}
 	}()
+}
+
+// schedule takes part in the node-resque scheduler leader election until the context is done.
+func (p *Poller) schedule(ctx context.Context, wg *sync.WaitGroup) {
+	opts := []noderesque.Option{
+		noderesque.WithLogger(p.logger),
+		noderesque.WithErrorHandler(func(err error) { p.errors.HandleError(&Error{Err: redisError(err)}) }),
+	}
+
+	if p.failures != nil {
+		opts = append(opts, noderesque.WithFailureBackend(p.failures))
+	}
 
-	return jobs
+	s := noderesque.NewScheduler(p.pool, opts...)
+	s.Namespace = p.Namespace
+
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+		s.Start(ctx, noderesque.DefaultInterval)
+	}()
 }
 
-func (p *Poller) pollTick(queues []string, jobs chan<- *job.Job) error {
+func (p *Poller) pollTick(queueSet *resolver, strategy Strategy, jobs chan<- *job.Job) error {
 	conn, err := p.pool.Conn()
 	if err != nil {
-		return err
+		return &Error{Err: redisError(err)}
 	}
 	defer conn.Close()
 
-	job, err := p.getJob(conn, queues)
+	queues, changed, err := queueSet.resolve(conn, time.Now())
+	if err != nil {
+		return &Error{Err: redisError(err)}
+	}
+
+	if changed {
+		p.logger.Info("queues resolved", logger.F("patterns", queueSet.patterns), logger.F(logger.KeyQueues, queues))
+	}
+
+	job, err := p.getJob(conn, strategy.Order(queues))
 	if err != nil {
 		return err
 	}
@@ -105,7 +302,7 @@ func (p *Poller) getJob(conn db.Conn, queues []string) (*job.Job, error) {
 	for _, queue := range queues {
 		res, err := conn.Do("LPOP", fmt.Sprintf("%s:queue:%s", p.Namespace, queue))
 		if err != nil {
-			return nil, err
+			return nil, &Error{Queue: queue, Err: redisError(err)}
 		}
 
 		if res == nil {
@@ -117,7 +314,7 @@ func (p *Poller) getJob(conn db.Conn, queues []string) (*job.Job, error) {
 		decoder := json.NewDecoder(bytes.NewReader(res.([]byte)))
 
 		if err := decoder.Decode(&job.Payload); err != nil {
-			return nil, err
+			return nil, &Error{Queue: queue, Err: fmt.Errorf("%w: %w", ErrDecode, err)}
 		}
 
 		return job, nil
@@ -3,7 +3,10 @@ package poller_test
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -11,6 +14,8 @@ import (
 	"github.com/snobb/goresq/pkg/db/mock"
 	"github.com/snobb/goresq/pkg/job"
 	"github.com/snobb/goresq/pkg/poller"
+	"github.com/snobb/goresq/test/assert"
+	"github.com/snobb/goresq/test/fakeredis"
 	"github.com/snobb/goresq/test/helpers"
 )
 
@@ -23,6 +28,7 @@ func TestPoller_Start(t *testing.T) {
 		job         interface{}
 		wantDbErr   bool
 		wantChanErr bool
+		wantErrIs   error
 		wantErr     bool
 	}{
 		{
@@ -63,6 +69,7 @@ func TestPoller_Start(t *testing.T) {
 			},
 			wantDbErr:   true,
 			wantChanErr: true,
+			wantErrIs:   poller.ErrRedis,
 		},
 		{
 			name:     "should poll and get a job but fail to decode job payload",
@@ -74,6 +81,7 @@ func TestPoller_Start(t *testing.T) {
 			concur:      1,
 			job:         "spanner",
 			wantChanErr: true,
+			wantErrIs:   poller.ErrDecode,
 		},
 	}
 
@@ -114,32 +122,203 @@ func TestPoller_Start(t *testing.T) {
 				},
 			}
 
-			p := poller.New(mockedPool, tt.interval, tt.concur)
+			var mu sync.Mutex
+			var errs []error
 
-			queues := []string{"queue1", "queue1"}
-			errors := make(chan error)
-			defer close(errors)
+			errorHandler := poller.ErrorHandlerFunc(func(e error) {
+				mu.Lock()
+				defer mu.Unlock()
+
+				if !tt.wantChanErr {
+					t.Errorf("Poller.Start() unexpected error: %#v", e)
+				}
 
+				errs = append(errs, e)
+			})
+
+			p := poller.New(mockedPool, tt.interval, tt.concur, poller.WithErrorHandler(errorHandler))
+
+			queues := []string{"queue1", "queue1"}
 			handlers := map[string]job.Handler{"foo": tt.perform}
 
 			ctx, cancel := context.WithTimeout(context.Background(), tt.interval+(5*time.Millisecond))
 			defer cancel()
 
-			go func() {
-				for {
-					select {
-					case <-ctx.Done():
-						return
-					case e := <-errors:
-						if e != nil && !tt.wantChanErr {
-							t.Errorf("Poller.Start() unexpected channel error: %#v", e)
-						}
-					}
+			if err := p.Start(ctx, queues, handlers); (err != nil) != tt.wantErr {
+				t.Errorf("Poller.Start() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantChanErr && len(errs) == 0 {
+				t.Errorf("Poller.Start() expected an error to be reported")
+			}
+
+			if tt.wantErrIs != nil {
+				for _, e := range errs {
+					var perr *poller.Error
+					assert.Eq(t, true, errors.As(e, &perr))
+					assert.Eq(t, true, errors.Is(e, tt.wantErrIs))
 				}
-			}()
+			}
+		})
+	}
+}
 
-			if err := p.Start(ctx, queues, handlers, errors); (err != nil) != tt.wantErr {
-				t.Errorf("Poller.Start() error = %v, wantErr %v", err, tt.wantErr)
+func TestPoller_StartPatterns(t *testing.T) {
+	tests := []struct {
+		name       string
+		queues     []string
+		wantQueues string
+		wantErr    bool
+	}{
+		{
+			name:       "all the queues",
+			queues:     []string{"*"},
+			wantQueues: "high,mail_a,mail_b,new",
+		},
+		{
+			name:       "pattern",
+			queues:     []string{"mail_*"},
+			wantQueues: "mail_a,mail_b",
+		},
+		{
+			name:       "queues before the pattern keep their priority",
+			queues:     []string{"mail_b", "*"},
+			wantQueues: "mail_b,high,mail_a,new",
+		},
+		{
+			name:    "invalid pattern",
+			queues:  []string{"mail_["},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rds := fakeredis.New()
+			for _, queue := range []string{"high", "mail_a", "mail_b"} {
+				_, _ = rds.Do("SADD", "resque:queues", queue)
+				_, _ = rds.Do("RPUSH", "resque:queue:"+queue, `{"class":"foo","args":[]}`)
+			}
+
+			var (
+				mu        sync.Mutex
+				performed []string
+			)
+
+			handlers := map[string]job.Handler{
+				"foo": job.PerformFunc(func(ctx context.Context, queue, class string, args []json.RawMessage) (job.Result, error) {
+					mu.Lock()
+					defer mu.Unlock()
+
+					performed = append(performed, queue)
+
+					// the queue created after the start is picked up at the next refresh.
+					if len(performed) == 1 {
+						_, _ = rds.Do("SADD", "resque:queues", "new")
+						_, _ = rds.Do("RPUSH", "resque:queue:new", `{"class":"foo","args":[]}`)
+					}
+
+					return nil, nil
+				}),
+			}
+
+			p := poller.New(rds.Pool(), 5*time.Millisecond, 1, poller.WithQueueRefresh(10*time.Millisecond))
+
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+
+			err := p.Start(ctx, tt.queues, handlers)
+			assert.Eq(t, tt.wantErr, err != nil)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if !tt.wantErr {
+				assert.Eq(t, tt.wantQueues, strings.Join(performed, ","))
+			}
+		})
+	}
+}
+
+func TestPoller_StartPools(t *testing.T) {
+	tests := []struct {
+		name         string
+		pools        []poller.Pool
+		wantCritical bool
+		wantErr      bool
+	}{
+		{
+			name: "bulk jobs occupy the shared workers",
+			pools: []poller.Pool{
+				{Queues: []string{"bulk", "critical"}, Concurrency: 2},
+			},
+			wantCritical: false,
+		},
+		{
+			name: "bulk jobs can not occupy the critical pool",
+			pools: []poller.Pool{
+				{Queues: []string{"critical"}, Concurrency: 1},
+				{Queues: []string{"bulk"}, Concurrency: 2},
+			},
+			wantCritical: true,
+		},
+		{
+			name: "invalid concurrency",
+			pools: []poller.Pool{
+				{Queues: []string{"critical"}, Concurrency: 0},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rds := fakeredis.New()
+			for i := 0; i < 10; i++ {
+				_, _ = rds.Do("RPUSH", "resque:queue:bulk", `{"class":"foo","args":[]}`)
+			}
+
+			_, _ = rds.Do("RPUSH", "resque:queue:critical", `{"class":"foo","args":[]}`)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+
+			var (
+				mu       sync.Mutex
+				critical bool
+				workers  int
+			)
+
+			handlers := map[string]job.Handler{
+				"foo": job.PerformFunc(func(ctx context.Context, queue, class string, args []json.RawMessage) (job.Result, error) {
+					if queue == "critical" {
+						mu.Lock()
+						critical = true
+						workers = len(rds.Members("resque:workers"))
+						mu.Unlock()
+
+						return nil, nil
+					}
+
+					// the bulk jobs hold their worker until the end of the test.
+					<-ctx.Done()
+
+					return nil, nil
+				}),
+			}
+
+			p := poller.New(rds.Pool(), time.Millisecond, 1)
+
+			err := p.StartPools(ctx, tt.pools, handlers)
+			assert.Eq(t, tt.wantErr, err != nil)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			assert.Eq(t, tt.wantCritical, critical)
+
+			if tt.wantCritical {
+				assert.Eq(t, 3, workers)
 			}
 		})
 	}
@@ -0,0 +1,103 @@
+package poller
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+
+	"github.com/snobb/goresq/pkg/db"
+)
+
+// DefaultQueueRefresh is the default interval between the resolutions of the queue patterns.
+const DefaultQueueRefresh = 5 * time.Second
+
+// isPattern reports whether the queue is a glob pattern such as * or mail_*.
+func isPattern(queue string) bool {
+	return strings.ContainsAny(queue, `*?[\`)
+}
+
+// validatePatterns returns an error if any of the queue patterns is malformed.
+func validatePatterns(queues []string) error {
+	for _, queue := range queues {
+		if _, err := path.Match(queue, ""); err != nil {
+			return fmt.Errorf("invalid queue pattern %q: %w", queue, err)
+		}
+	}
+
+	return nil
+}
+
+// resolver resolves the queue patterns against the queues registered in <ns>:queues. The
+// resolution is cached for the refresh interval so that the new queues are picked up without
+// querying redis on every poll.
+type resolver struct {
+	namespace  string
+	patterns   []string
+	refresh    time.Duration
+	queues     []string
+	resolvedAt time.Time
+}
+
+func newResolver(namespace string, patterns []string, refresh time.Duration) *resolver {
+	r := &resolver{namespace: namespace, patterns: patterns, refresh: refresh}
+
+	for _, queue := range patterns {
+		if isPattern(queue) {
+			return r
+		}
+	}
+
+	// no pattern, the queues never change.
+	r.queues = patterns
+	r.refresh = 0
+
+	return r
+}
+
+// resolve returns the queues to poll in priority order: the queues in the order of the
+// patterns and the queues matching the same pattern in alphabetical order, like Resque does.
+// The second result reports whether the queues have changed since the last resolution.
+func (r *resolver) resolve(conn db.Conn, now time.Time) ([]string, bool, error) {
+	if r.refresh == 0 || (r.queues != nil && now.Sub(r.resolvedAt) < r.refresh) {
+		return r.queues, false, nil
+	}
+
+	registered, err := redis.Strings(conn.Do("SMEMBERS", fmt.Sprintf("%s:queues", r.namespace)))
+	if err != nil {
+		return nil, false, err
+	}
+
+	sort.Strings(registered)
+
+	queues := []string{}
+	seen := map[string]bool{}
+
+	add := func(queue string) {
+		if !seen[queue] {
+			seen[queue] = true
+			queues = append(queues, queue)
+		}
+	}
+
+	for _, pattern := range r.patterns {
+		if !isPattern(pattern) {
+			add(pattern)
+			continue
+		}
+
+		for _, queue := range registered {
+			if ok, _ := path.Match(pattern, queue); ok {
+				add(queue)
+			}
+		}
+	}
+
+	changed := strings.Join(queues, ",") != strings.Join(r.queues, ",")
+	r.queues, r.resolvedAt = queues, now
+
+	return queues, changed, nil
+}
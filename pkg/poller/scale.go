@@ -0,0 +1,226 @@
+package poller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+
+	"github.com/snobb/goresq/pkg/job"
+	"github.com/snobb/goresq/pkg/logger"
+)
+
+// The defaults of the autoscaler.
+const (
+	DefaultScaleInterval    = 5 * time.Second
+	DefaultScaleIdleTimeout = time.Minute
+	DefaultScaleThreshold   = 10
+)
+
+// Autoscale configures the autoscaler of a pool. The autoscaler adds workers when the queues of
+// the pool are deep and retires the idle workers down to the minimum.
+type Autoscale struct {
+	// Min and Max bound the number of workers. Min must be at least 1.
+	Min, Max int
+	// Threshold is the number of pending jobs per worker above which workers are added.
+	Threshold int
+	// IdleTimeout is how long a worker must wait for a job before it is retired.
+	IdleTimeout time.Duration
+	// Interval is the interval between the checks of the queue depths.
+	Interval time.Duration
+}
+
+func (a *Autoscale) validate() error {
+	if a.Min < 1 || a.Max < a.Min {
+		return fmt.Errorf("invalid autoscale bounds %d..%d", a.Min, a.Max)
+	}
+
+	return nil
+}
+
+func (a Autoscale) withDefaults() Autoscale {
+	if a.Threshold <= 0 {
+		a.Threshold = DefaultScaleThreshold
+	}
+
+	if a.IdleTimeout <= 0 {
+		a.IdleTimeout = DefaultScaleIdleTimeout
+	}
+
+	if a.Interval <= 0 {
+		a.Interval = DefaultScaleInterval
+	}
+
+	return a
+}
+
+// The retries of a worker failing to start.
+const (
+	startAttempts = 5
+	startBackoff  = 50 * time.Millisecond
+)
+
+// group holds the running workers of a pool.
+type group struct {
+	mu       sync.Mutex
+	poller   *Poller
+	pool     Pool
+	jobs     <-chan *job.Job
+	handlers map[string]job.Handler
+	wg       *sync.WaitGroup
+	workers  []*Worker
+}
+
+func (g *group) size() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return len(g.workers)
+}
+
+// resize starts or stops the workers so that the group has n workers. The last started workers
+// are stopped first. The error of a worker failing to start is returned, the workers started so
+// far are kept.
+func (g *group) resize(ctx context.Context, n int) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	from := len(g.workers)
+
+	var err error
+
+	for len(g.workers) < n {
+		if err = g.start(ctx); err != nil {
+			break
+		}
+	}
+
+	for len(g.workers) > n {
+		last := len(g.workers) - 1
+		g.workers[last].Stop()
+		g.workers = g.workers[:last]
+	}
+
+	if len(g.workers) != from {
+		g.poller.logger.Info("worker pool resized", logger.F(logger.KeyQueues, g.pool.Queues),
+			logger.F("from", from), logger.F("to", len(g.workers)))
+	}
+
+	return err
+}
+
+// retireIdle stops the workers idle for longer than the timeout, keeping at least min workers.
+func (g *group) retireIdle(timeout time.Duration, min int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	from := len(g.workers)
+	now := time.Now()
+	workers := g.workers[:0]
+
+	for i, w := range g.workers {
+		if len(g.workers)-i+len(workers) > min && w.idle(now) > timeout {
+			w.Stop()
+			continue
+		}
+
+		workers = append(workers, w)
+	}
+
+	g.workers = workers
+
+	if len(g.workers) != from {
+		g.poller.logger.Info("idle workers retired", logger.F(logger.KeyQueues, g.pool.Queues),
+			logger.F("from", from), logger.F("to", len(g.workers)))
+	}
+}
+
+// start starts a new worker. The registration is retried with a backoff a few times unless
+// the context is done.
+func (g *group) start(ctx context.Context) error {
+	id := g.poller.nextWorkerID()
+	backoff := startBackoff
+
+	for attempt := 1; ; attempt++ {
+		w := NewWorker(id, g.poller.Namespace, g.pool.Queues, g.handlers, g.poller.pool, g.poller.opts...)
+
+		err := w.Work(ctx, g.jobs, g.wg)
+		if err == nil {
+			g.workers = append(g.workers, w)
+			return nil
+		}
+
+		// a failing hook would fail again, only the redis failures are retried.
+		if errors.Is(err, ErrHook) || attempt == startAttempts {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+	}
+}
+
+// autoscale adjusts the number of workers to the depth of the queues until the context is done.
+func (g *group) autoscale(ctx context.Context) {
+	scale := g.pool.Autoscale.withDefaults()
+	queueSet := newResolver(g.poller.Namespace, g.pool.Queues, g.poller.queueRefresh)
+
+	ticker := time.NewTicker(scale.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-ticker.C:
+			depth, err := g.depth(queueSet)
+			if err != nil {
+				g.poller.errors.HandleError(&Error{Err: redisError(err)})
+				continue
+			}
+
+			// the workers failing to start have reported their errors.
+			if want := (depth + scale.Threshold - 1) / scale.Threshold; want > g.size() {
+				_ = g.resize(ctx, min(want, scale.Max))
+			} else if depth == 0 {
+				g.retireIdle(scale.IdleTimeout, scale.Min)
+			}
+		}
+	}
+}
+
+// depth returns the number of pending jobs in the queues of the group.
+func (g *group) depth(queueSet *resolver) (int, error) {
+	conn, err := g.poller.pool.Conn()
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	queues, _, err := queueSet.resolve(conn, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	var depth int
+
+	for _, queue := range queues {
+		n, err := redis.Int(conn.Do("LLEN", fmt.Sprintf("%s:queue:%s", g.poller.Namespace, queue)))
+		if err != nil {
+			return 0, err
+		}
+
+		depth += n
+	}
+
+	return depth, nil
+}
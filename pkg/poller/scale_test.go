@@ -0,0 +1,185 @@
+package poller_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/snobb/goresq/pkg/db"
+	"github.com/snobb/goresq/pkg/db/mock"
+	"github.com/snobb/goresq/pkg/job"
+	"github.com/snobb/goresq/pkg/poller"
+
+	"github.com/snobb/goresq/test/assert"
+	"github.com/snobb/goresq/test/fakeredis"
+)
+
+// eventually waits for the condition to hold.
+func eventually(t *testing.T, cond func() bool) bool {
+	t.Helper()
+
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); {
+		if cond() {
+			return true
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	return false
+}
+
+func TestPoller_SetConcurrency(t *testing.T) {
+	rds := fakeredis.New()
+	p := poller.New(rds.Pool(), time.Millisecond, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+		assert.Eq(t, nil, p.Start(ctx, []string{"queue1"}, map[string]job.Handler{}))
+	}()
+
+	workers := func(n int) func() bool {
+		return func() bool { return len(rds.Members("resque:workers")) == n }
+	}
+
+	assert.Eq(t, true, eventually(t, workers(1)))
+
+	assert.Eq(t, nil, p.SetConcurrency(3))
+	assert.Eq(t, true, eventually(t, workers(3)))
+	assert.Eq(t, 3, p.Concurrency()[0])
+
+	assert.Eq(t, nil, p.SetConcurrency(1))
+	assert.Eq(t, true, eventually(t, workers(1)))
+	assert.Eq(t, 1, p.Concurrency()[0])
+
+	assert.Eq(t, true, p.SetConcurrency(0) != nil)
+	assert.Eq(t, true, p.SetPoolConcurrency(1, 1) != nil)
+
+	cancel()
+	wg.Wait()
+
+	assert.Eq(t, 0, len(rds.Members("resque:workers")))
+
+	// the stopped poller starts no more workers.
+	assert.Eq(t, true, errors.Is(p.SetConcurrency(2), poller.ErrStopped))
+	assert.Eq(t, 0, len(p.Concurrency()))
+	assert.Eq(t, 0, len(rds.Members("resque:workers")))
+}
+
+func TestPoller_StartAutoscale(t *testing.T) {
+	rds := fakeredis.New()
+	for i := 0; i < 40; i++ {
+		_, _ = rds.Do("RPUSH", "resque:queue:bulk", `{"class":"foo","args":[]}`)
+	}
+
+	var running, peak atomic.Int32
+
+	handlers := map[string]job.Handler{
+		"foo": job.PerformFunc(func(ctx context.Context, queue, class string, args []json.RawMessage) (job.Result, error) {
+			n := running.Add(1)
+			defer running.Add(-1)
+
+			for {
+				if old := peak.Load(); n <= old || peak.CompareAndSwap(old, n) {
+					break
+				}
+			}
+
+			time.Sleep(5 * time.Millisecond)
+
+			return nil, nil
+		}),
+	}
+
+	p := poller.New(rds.Pool(), time.Millisecond, 1, poller.WithAutoscale(poller.Autoscale{
+		Min: 1, Max: 4, Threshold: 5, IdleTimeout: 20 * time.Millisecond, Interval: 5 * time.Millisecond,
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+		assert.Eq(t, nil, p.Start(ctx, []string{"bulk"}, handlers))
+	}()
+
+	// the deep queue scales the workers up to the maximum, the idle workers are then retired
+	// down to the minimum once the queue is drained.
+	assert.Eq(t, true, eventually(t, func() bool { return len(rds.List("resque:queue:bulk")) == 0 }))
+	assert.Eq(t, true, eventually(t, func() bool { return len(rds.Members("resque:workers")) == 1 }))
+	assert.Eq(t, int32(4), peak.Load())
+
+	cancel()
+	wg.Wait()
+}
+
+func TestPoller_StartAutoscaleInvalid(t *testing.T) {
+	p := poller.New(fakeredis.New().Pool(), time.Millisecond, 1, poller.WithAutoscale(poller.Autoscale{Min: 2, Max: 1}))
+
+	assert.Eq(t, true, p.Start(context.Background(), []string{"bulk"}, map[string]job.Handler{}) != nil)
+}
+
+func TestPoller_StartWorkerRetries(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		attempts int
+	)
+
+	mockedConn := &mock.ConnMock{
+		CloseFunc: func() error { return nil },
+		FlushFunc: func() error { return nil },
+		SendFunc: func(commandName string, args ...interface{}) error {
+			mu.Lock()
+			defer mu.Unlock()
+
+			if commandName == "SADD" {
+				attempts++
+			}
+
+			return fmt.Errorf("db spanner")
+		},
+	}
+
+	mockedPool := &mock.PoolerMock{
+		ConnFunc: func() (db.Conn, error) { return mockedConn, nil },
+	}
+
+	p := poller.New(mockedPool, time.Millisecond, 1, poller.WithErrorHandler(poller.ErrorHandlerFunc(func(error) {})))
+
+	err := p.Start(context.Background(), []string{"queue1"}, map[string]job.Handler{})
+	assert.Eq(t, true, errors.Is(err, poller.ErrRedis))
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	// the registration is retried a few times before the poller gives up.
+	assert.Eq(t, 5, attempts)
+}
+
+func TestPoller_StartPoolsLeavesPools(t *testing.T) {
+	p := poller.New(fakeredis.New().Pool(), time.Millisecond, 1, poller.WithAutoscale(poller.Autoscale{Min: 2, Max: 4}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	pools := []poller.Pool{{Queues: []string{"queue1"}, Concurrency: 1}}
+
+	assert.Eq(t, nil, p.StartPools(ctx, pools, map[string]job.Handler{}))
+	assert.Eq(t, 1, pools[0].Concurrency)
+	assert.Eq(t, true, pools[0].Autoscale == nil)
+	assert.Eq(t, true, pools[0].Strategy == nil)
+}
@@ -0,0 +1,123 @@
+package poller
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Strategy orders the queues the poller tries to pop a job from on each poll. The first
+// non-empty queue of the order is served.
+type Strategy interface {
+	Order(queues []string) []string
+}
+
+// StrategyFunc is a function implementing Strategy.
+type StrategyFunc func(queues []string) []string
+
+// Order returns the order of the queues.
+func (f StrategyFunc) Order(queues []string) []string {
+	return f(queues)
+}
+
+// Strict polls the queues in the given order so that a queue is only served when all the
+// queues before it are empty. It is the default strategy.
+func Strict() Strategy {
+	return StrategyFunc(func(queues []string) []string {
+		return queues
+	})
+}
+
+// RoundRobin starts each poll with the queue following the one the previous poll started with
+// so that every queue gets its turn to be served first.
+func RoundRobin() Strategy {
+	var (
+		mu   sync.Mutex
+		next int
+	)
+
+	return StrategyFunc(func(queues []string) []string {
+		if len(queues) == 0 {
+			return queues
+		}
+
+		mu.Lock()
+		start := next % len(queues)
+		next = start + 1
+		mu.Unlock()
+
+		return append(append(make([]string, 0, len(queues)), queues[start:]...), queues[:start]...)
+	})
+}
+
+// Shuffled polls the queues in a random order so that every queue is equally likely to be
+// served first.
+func Shuffled() Strategy {
+	return StrategyFunc(func(queues []string) []string {
+		res := append([]string(nil), queues...)
+		rand.Shuffle(len(res), func(i, j int) { res[i], res[j] = res[j], res[i] })
+
+		return res
+	})
+}
+
+// Weighted polls the queues in a random order where the chance of a queue to come before the
+// others is proportional to its weight. The queues without a weight, or with a weight that is
+// not positive, have the weight 1.
+func Weighted(weights map[string]int) Strategy {
+	return StrategyFunc(func(queues []string) []string {
+		remaining := append([]string(nil), queues...)
+		res := make([]string, 0, len(queues))
+
+		for len(remaining) > 0 {
+			var total int
+			for _, queue := range remaining {
+				total += weight(weights, queue)
+			}
+
+			n := rand.IntN(total)
+
+			for i, queue := range remaining {
+				if n -= weight(weights, queue); n < 0 {
+					res = append(res, queue)
+					remaining = append(remaining[:i], remaining[i+1:]...)
+
+					break
+				}
+			}
+		}
+
+		return res
+	})
+}
+
+func weight(weights map[string]int, queue string) int {
+	if w, ok := weights[queue]; ok && w > 0 {
+		return w
+	}
+
+	return 1
+}
+
+// ParseWeights parses the queue weights in the critical:5,default:2,low:1 format.
+func ParseWeights(s string) (map[string]int, error) {
+	weights := map[string]int{}
+
+	for _, item := range strings.Split(s, ",") {
+		queue, value, ok := strings.Cut(strings.TrimSpace(item), ":")
+		if !ok || queue == "" {
+			return nil, fmt.Errorf("invalid queue weight %q", item)
+		}
+
+		w, err := strconv.Atoi(value)
+		if err != nil || w <= 0 {
+			return nil, fmt.Errorf("invalid queue weight %q: must be a positive integer", item)
+		}
+
+		weights[queue] = w
+	}
+
+	return weights, nil
+}
@@ -0,0 +1,196 @@
+package poller_test
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/snobb/goresq/pkg/job"
+	"github.com/snobb/goresq/pkg/poller"
+
+	"github.com/snobb/goresq/test/assert"
+	"github.com/snobb/goresq/test/fakeredis"
+)
+
+func TestStrategy_Order(t *testing.T) {
+	const rounds = 12000
+
+	queues := []string{"critical", "default", "low"}
+
+	tests := []struct {
+		name      string
+		strategy  poller.Strategy
+		wantFirst map[string]float64
+		wantOrder string
+	}{
+		{
+			name:      "strict",
+			strategy:  poller.Strict(),
+			wantFirst: map[string]float64{"critical": 1},
+			wantOrder: "critical,default,low",
+		},
+		{
+			name:      "round-robin",
+			strategy:  poller.RoundRobin(),
+			wantFirst: map[string]float64{"critical": 1.0 / 3, "default": 1.0 / 3, "low": 1.0 / 3},
+		},
+		{
+			name:      "shuffled",
+			strategy:  poller.Shuffled(),
+			wantFirst: map[string]float64{"critical": 1.0 / 3, "default": 1.0 / 3, "low": 1.0 / 3},
+		},
+		{
+			name:      "weighted",
+			strategy:  poller.Weighted(map[string]int{"critical": 5, "default": 2, "low": 1}),
+			wantFirst: map[string]float64{"critical": 5.0 / 8, "default": 2.0 / 8, "low": 1.0 / 8},
+		},
+		{
+			name:      "weighted defaults to 1",
+			strategy:  poller.Weighted(map[string]int{"critical": 2}),
+			wantFirst: map[string]float64{"critical": 2.0 / 4, "default": 1.0 / 4, "low": 1.0 / 4},
+		},
+		{
+			name:      "weighted clamps the non-positive weights to 1",
+			strategy:  poller.Weighted(map[string]int{"critical": 0, "default": -3, "low": 2}),
+			wantFirst: map[string]float64{"critical": 1.0 / 4, "default": 1.0 / 4, "low": 2.0 / 4},
+		},
+		{
+			name:      "weighted with only zero weights",
+			strategy:  poller.Weighted(map[string]int{"critical": 0, "default": 0, "low": 0}),
+			wantFirst: map[string]float64{"critical": 1.0 / 3, "default": 1.0 / 3, "low": 1.0 / 3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first := map[string]int{}
+
+			for i := 0; i < rounds; i++ {
+				order := tt.strategy.Order(queues)
+				assert.Eq(t, len(queues), len(order))
+
+				if tt.wantOrder != "" {
+					assert.Eq(t, tt.wantOrder, strings.Join(order, ","))
+				}
+
+				first[order[0]]++
+			}
+
+			for _, queue := range queues {
+				share := float64(first[queue]) / rounds
+				if math.Abs(share-tt.wantFirst[queue]) > 0.03 {
+					t.Errorf("queue %s served first %.3f of the polls, want %.3f", queue, share, tt.wantFirst[queue])
+				}
+			}
+
+			assert.Eq(t, "critical,default,low", strings.Join(queues, ","))
+		})
+	}
+}
+
+func TestParseWeights(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    map[string]int
+		wantErr bool
+	}{
+		{
+			name: "weights",
+			s:    "critical:5, default:2,low:1",
+			want: map[string]int{"critical": 5, "default": 2, "low": 1},
+		},
+		{
+			name:    "missing weight",
+			s:       "critical",
+			wantErr: true,
+		},
+		{
+			name:    "zero weight",
+			s:       "critical:0",
+			wantErr: true,
+		},
+		{
+			name:    "missing queue",
+			s:       ":1",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := poller.ParseWeights(tt.s)
+			assert.Eq(t, tt.wantErr, err != nil)
+			assert.Eq(t, len(tt.want), len(got))
+
+			for queue, w := range tt.want {
+				assert.Eq(t, w, got[queue])
+			}
+		})
+	}
+}
+
+func TestPoller_StartStrategy(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy poller.Strategy
+		wantLow  bool
+	}{
+		{
+			name:     "strict starves the low queue",
+			strategy: poller.Strict(),
+			wantLow:  false,
+		},
+		{
+			name:     "round-robin serves the low queue",
+			strategy: poller.RoundRobin(),
+			wantLow:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rds := fakeredis.New()
+			for i := 0; i < 100; i++ {
+				_, _ = rds.Do("RPUSH", "resque:queue:busy", `{"class":"foo","args":[]}`)
+			}
+
+			_, _ = rds.Do("RPUSH", "resque:queue:low", `{"class":"foo","args":[]}`)
+
+			var (
+				mu        sync.Mutex
+				performed []string
+			)
+
+			handlers := map[string]job.Handler{
+				"foo": job.PerformFunc(func(ctx context.Context, queue, class string, args []json.RawMessage) (job.Result, error) {
+					mu.Lock()
+					defer mu.Unlock()
+
+					performed = append(performed, queue)
+
+					return nil, nil
+				}),
+			}
+
+			p := poller.New(rds.Pool(), time.Millisecond, 1, poller.WithStrategy(tt.strategy))
+
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+
+			assert.Eq(t, nil, p.Start(ctx, []string{"busy", "low"}, handlers))
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			// the busy queue is never drained within the test, the low queue is only served
+			// when the strategy is fair.
+			assert.Eq(t, true, len(rds.List("resque:queue:busy")) > 0)
+			assert.Eq(t, tt.wantLow, strings.Contains(strings.Join(performed, ","), "low"))
+		})
+	}
+}
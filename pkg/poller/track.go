@@ -1,12 +1,17 @@
 package poller
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"strings"
 	"time"
 
 	"github.com/snobb/goresq/pkg/db"
+	"github.com/snobb/goresq/pkg/job"
+	"github.com/snobb/goresq/pkg/logger"
+	"github.com/snobb/goresq/pkg/noderesque"
+	"github.com/snobb/goresq/pkg/stats"
 )
 
 // Track represents a redis connection tracker.
@@ -16,9 +21,11 @@ type Track struct {
 	ID        string
 	Namespace string
 	Queues    []string
+	log       logger.Logger
+	ping      bool
 }
 
-func newTrack(id, ns string, queues []string) Track {
+func newTrack(id, ns string, queues []string, log logger.Logger, ping bool) Track {
 	hostname, err := os.Hostname()
 	if err != nil {
 		panic(err)
@@ -30,6 +37,8 @@ func newTrack(id, ns string, queues []string) Track {
 		ID:        id,
 		Namespace: ns,
 		Queues:    queues,
+		log:       log,
+		ping:      ping,
 	}
 }
 
@@ -37,16 +46,21 @@ func (t *Track) String() string {
 	return fmt.Sprintf("%s:%d-%s:%s", t.Hostname, t.Pid, t.ID, strings.Join(t.Queues, ","))
 }
 
+// name returns the worker id without the queues, the name node-resque knows the worker by.
+func (t *Track) name() string {
+	return fmt.Sprintf("%s:%d-%s", t.Hostname, t.Pid, t.ID)
+}
+
 func (t *Track) track(conn db.Conn) error {
 	if err := conn.Send("SADD", fmt.Sprintf("%s:workers", t.Namespace), t); err != nil {
 		return err
 	}
 
-	if err := conn.Send("SET", fmt.Sprintf("%s:stat:processed:%v", t.Namespace, t), "0"); err != nil {
+	if err := conn.Send("SET", stats.WorkerKey(t.Namespace, t.String(), stats.Processed), "0"); err != nil {
 		return err
 	}
 
-	if err := conn.Send("SET", fmt.Sprintf("%s:stat:failed:%v", t.Namespace, t), "0"); err != nil {
+	if err := conn.Send("SET", stats.WorkerKey(t.Namespace, t.String(), stats.Failed), "0"); err != nil {
 		return err
 	}
 
@@ -54,8 +68,14 @@ func (t *Track) track(conn db.Conn) error {
 		return err
 	}
 
+	if err := t.heartbeat(conn); err != nil {
+		return err
+	}
+
 	_ = conn.Flush()
 
+	t.log.Debug("worker registered", logger.F(logger.KeyWorker, t.String()))
+
 	return nil
 }
 
@@ -64,50 +84,127 @@ func (t *Track) untrack(conn db.Conn) error {
 		return err
 	}
 
-	if err := conn.Send("DEL", fmt.Sprintf("%s:stat:processed:%s", t.Namespace, t)); err != nil {
-		return err
+	for _, name := range stats.Names() {
+		if err := conn.Send("DEL", stats.WorkerKey(t.Namespace, t.String(), name)); err != nil {
+			return err
+		}
 	}
 
-	if err := conn.Send("DEL", fmt.Sprintf("%s:stat:failed:%s", t.Namespace, t)); err != nil {
+	if err := conn.Send("DEL", fmt.Sprintf("%s:worker:%s", t.Namespace, t)); err != nil {
 		return err
 	}
 
-	if err := conn.Send("DEL", fmt.Sprintf("%s:worker:%s", t.Namespace, t)); err != nil {
+	if err := conn.Send("DEL", fmt.Sprintf("%s:worker:%s:started", t.Namespace, t)); err != nil {
 		return err
 	}
 
-	if err := conn.Send("DEL", fmt.Sprintf("%s:worker:%s:started", t.Namespace, t)); err != nil {
+	if err := conn.Send("HDEL", fmt.Sprintf("%s:workers:heartbeat", t.Namespace), t); err != nil {
 		return err
 	}
 
+	if t.ping {
+		if err := conn.Send("DEL", noderesque.PingKey(t.Namespace, t.name())); err != nil {
+			return err
+		}
+
+		if err := conn.Send("DEL", noderesque.JobKey(t.Namespace, t.name())); err != nil {
+			return err
+		}
+	}
+
 	_ = conn.Flush()
 
+	t.log.Debug("worker unregistered", logger.F(logger.KeyWorker, t.String()))
+
+	return nil
+}
+
+// heartbeat records the time the worker was last seen alive in the same hash as Resque does
+// and, with WithNodeResque, in the node-resque ping.
+func (t *Track) heartbeat(conn db.Conn) error {
+	now := time.Now()
+
+	if err := conn.Send("HSET", fmt.Sprintf("%s:workers:heartbeat", t.Namespace), t,
+		now.UTC().Format(time.RFC3339)); err != nil {
+		return err
+	}
+
+	if t.ping {
+		return noderesque.SendPing(conn, t.Namespace, t.name(), t.Queues, now)
+	}
+
 	return nil
 }
 
-func (t *Track) success(conn db.Conn) error {
-	if err := conn.Send("INCR", fmt.Sprintf("%s:stat:processed", t.Namespace)); err != nil {
+func (t *Track) working(conn db.Conn, jb *job.Job) error {
+	buf, err := json.Marshal(struct {
+		Queue   string      `json:"queue"`
+		RunAt   string      `json:"run_at"`
+		Payload job.Payload `json:"payload"`
+	}{jb.Queue, time.Now().UTC().Format(time.RFC3339), jb.Payload})
+	if err != nil {
 		return err
 	}
 
-	if err := conn.Send("INCR", fmt.Sprintf("%s:stat:processed:%s", t.Namespace, t)); err != nil {
+	if err := conn.Send("SET", fmt.Sprintf("%s:worker:%s", t.Namespace, t), buf); err != nil {
 		return err
 	}
 
-	_ = conn.Flush()
+	// node-resque looks the job of a worker up by the worker name.
+	if t.ping {
+		if err := conn.Send("SET", noderesque.JobKey(t.Namespace, t.name()), buf); err != nil {
+			return err
+		}
+	}
 
-	return nil
+	return conn.Flush()
 }
 
-func (t *Track) fail(conn db.Conn) error {
-	if err := conn.Send("INCR", fmt.Sprintf("%s:stat:failed", t.Namespace)); err != nil {
+func (t *Track) done(conn db.Conn) error {
+	if err := conn.Send("DEL", fmt.Sprintf("%s:worker:%s", t.Namespace, t)); err != nil {
 		return err
 	}
 
-	if err := conn.Send("INCR", fmt.Sprintf("%s:stat:failed:%s", t.Namespace, t)); err != nil {
+	if t.ping {
+		return conn.Send("DEL", noderesque.JobKey(t.Namespace, t.name()))
+	}
+
+	return nil
+}
+
+func (t *Track) success(conn db.Conn, queue string) error {
+	return t.count(conn, queue, stats.Processed)
+}
+
+func (t *Track) fail(conn db.Conn, queue string) error {
+	return t.count(conn, queue, stats.Failed)
+}
+
+// requeue pushes the job back to the end of its queue. The reply is read so that the job is
+// known to be back in the queue.
+func (t *Track) requeue(conn db.Conn, jb *job.Job) error {
+	buf, err := json.Marshal(jb.Payload)
+	if err != nil {
 		return err
 	}
 
+	_, err = conn.Do("RPUSH", fmt.Sprintf("%s:queue:%s", t.Namespace, jb.Queue), buf)
+
+	return err
+}
+
+// count increments the global, the worker and the queue counters.
+func (t *Track) count(conn db.Conn, queue, name string) error {
+	for _, key := range []string{
+		stats.TotalKey(t.Namespace, name),
+		stats.WorkerKey(t.Namespace, t.String(), name),
+		stats.QueueKey(t.Namespace, queue, name),
+	} {
+		if err := conn.Send("INCR", key); err != nil {
+			return err
+		}
+	}
+
 	_ = conn.Flush()
 
 	return nil
@@ -2,13 +2,19 @@ package poller
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/snobb/goresq/pkg/db"
+	"github.com/snobb/goresq/pkg/failure"
 	"github.com/snobb/goresq/pkg/job"
+	"github.com/snobb/goresq/pkg/logger"
+	"github.com/snobb/goresq/pkg/metrics"
+	"github.com/snobb/goresq/pkg/stats"
+	"github.com/snobb/goresq/pkg/trace"
 )
 
 // Worker represents a queue worker.
@@ -17,45 +23,124 @@ type Worker struct {
 	runAt    time.Time
 	pool     db.Pooler
 	handlers map[string]job.Handler
+	failures failure.Backend
+	quit     chan struct{}
+	stopOnce sync.Once
+	// idleSince is the unix time in nanoseconds the worker became idle, 0 while it is working.
+	idleSince atomic.Int64
+	options
 }
 
-const connCoolDown = 1 * time.Second
-
 // NewWorker creates a new worker.
-func NewWorker(id int, namespace string, queues []string, handlers map[string]job.Handler, pool db.Pooler) *Worker {
+func NewWorker(id int, namespace string, queues []string, handlers map[string]job.Handler, pool db.Pooler,
+	opts ...Option,
+) *Worker {
+	o := newOptions(opts)
+
+	failures := o.failures
+	if failures == nil {
+		redis := failure.NewRedis(pool)
+		redis.Namespace = namespace
+		failures = redis
+	}
+
 	return &Worker{
-		Track:    newTrack(fmt.Sprintf("worker%d", id), namespace, queues),
+		Track:    newTrack(fmt.Sprintf("worker%d", id), namespace, queues, o.logger, o.nodeResque),
 		runAt:    time.Now(),
 		pool:     pool,
 		handlers: handlers,
+		failures: failures,
+		quit:     make(chan struct{}),
+		options:  o,
+	}
+}
+
+// Stop makes the worker unregister and exit once the current job, if any, is finished.
+func (w *Worker) Stop() {
+	w.stopOnce.Do(func() { close(w.quit) })
+}
+
+// idle returns how long the worker has been waiting for a job, 0 if it is working.
+func (w *Worker) idle(now time.Time) time.Duration {
+	since := w.idleSince.Load()
+	if since == 0 {
+		return 0
 	}
+
+	return now.Sub(time.Unix(0, since))
 }
 
-// Work is a method that starts job worker and processes jobs.
-func (w *Worker) Work(ctx context.Context, jobs <-chan *job.Job, wg *sync.WaitGroup, errors chan<- error) error {
+// Work is a method that starts job worker and processes jobs. The errors are reported to the
+// error handler set with WithErrorHandler.
+func (w *Worker) Work(ctx context.Context, jobs <-chan *job.Job, wg *sync.WaitGroup) error {
 	if err := w.track(); err != nil {
-		errors <- err
+		err = w.wrapError(nil, err)
+		w.reportError("worker registration failed", err)
+		return err
+	}
+
+	ctx, err := w.hooks.startWorker(ctx, w)
+	if err != nil {
+		if err := w.untrack(); err != nil {
+			w.reportError("worker unregistration failed", w.wrapError(nil, err))
+		}
+
+		err = w.wrapError(nil, err)
+		w.reportError("worker start hook failed", err)
+
 		return err
 	}
 
 	wg.Add(1)
+	w.idleSince.Store(time.Now().UnixNano())
+
+	w.logger.Info("worker started", logger.F(logger.KeyWorker, w.String()))
 
 	go func() {
+		stop := make(chan struct{})
+		beating := make(chan struct{})
+
+		go func() {
+			defer close(beating)
+			w.beatUntil(stop)
+		}()
+
 		defer func() {
+			close(stop)
+			<-beating
+
+			w.hooks.stopWorker(ctx, w)
+
 			if err := w.untrack(); err != nil {
-				errors <- err
+				w.reportError("worker unregistration failed", w.wrapError(nil, err))
 			}
 
+			w.logger.Info("worker stopped", logger.F(logger.KeyWorker, w.String()))
 			wg.Done()
 		}()
 
-		for jb := range jobs {
-			if jb == nil {
-				continue
-			}
+		for {
+			select {
+			case jb, ok := <-jobs:
+				if !ok {
+					return
+				}
+
+				if jb == nil {
+					w.hooks.idleWorker(ctx, w)
+					continue
+				}
+
+				w.idleSince.Store(0)
+
+				if err := w.handleJob(ctx, jb); err != nil {
+					w.errors.HandleError(w.wrapError(jb, err))
+				}
 
-			if err := w.handleJob(ctx, jb); err != nil {
-				errors <- err
+				w.idleSince.Store(time.Now().UnixNano())
+
+			case <-w.quit:
+				return
 			}
 		}
 	}()
@@ -66,99 +151,221 @@ func (w *Worker) Work(ctx context.Context, jobs <-chan *job.Job, wg *sync.WaitGr
 func (w *Worker) handleJob(ctx context.Context, jb *job.Job) error {
 	conn, err := w.pool.Conn()
 	if err != nil {
-		return err
+		return redisError(err)
 	}
 	defer conn.Close()
 
-	if err = w.run(ctx, jb); err != nil {
+	var wait time.Duration
+	if jb.Payload.EnqueuedAt > 0 {
+		wait = time.Since(job.Time(jb.Payload.EnqueuedAt))
+	}
+
+	fields := w.jobFields(jb)
+
+	// the job has already been taken from the queue, a tracking failure is reported but does
+	// not prevent the job from being performed and accounted.
+	if err := w.Track.working(conn, jb); err != nil {
+		w.reportError("job tracking failed", w.wrapError(jb, redisError(err)))
+	}
+
+	w.recorder.JobStarted(jb.Queue, jb.Payload.Class, wait)
+	w.logger.Debug("job started", fields...)
+	start := time.Now()
+
+	err = w.run(ctx, jb)
+
+	if err := w.Track.done(conn); err != nil {
+		w.reportError("job tracking failed", w.wrapError(jb, redisError(err)))
+	}
+
+	duration := time.Since(start)
+
+	switch {
+	case err == nil:
+		w.recorder.JobFinished(jb.Queue, jb.Payload.Class, metrics.OutcomeSuccess, duration)
+		w.logger.Info("job finished", append(fields, logger.F(logger.KeyDuration, duration))...)
+
+		if err := w.success(conn, jb); err != nil {
+			return redisError(err)
+		}
+
+	case job.Aborted(err):
+		if err := w.abort(conn, jb, err, duration, fields); err != nil {
+			return redisError(err)
+		}
+
+		return nil
+
+	default:
+		w.recorder.JobFinished(jb.Queue, jb.Payload.Class, metrics.OutcomeFailure, duration)
+		w.logger.Error("job failed", append(fields, logger.F(logger.KeyDuration, duration), logger.F(logger.KeyError, err))...)
+
 		if err := w.fail(conn, jb, err); err != nil {
-			return err
+			return redisError(err)
 		}
-	} else {
-		if err := w.success(conn, jb); err != nil {
-			return err
+	}
+
+	return err
+}
+
+// abort records a job aborted with job.ErrSkip, job.ErrRequeue or job.ErrDiscard. A requeued
+// job is pushed back to its queue, or saved to the failure backend if that fails.
+func (w *Worker) abort(conn db.Conn, jb *job.Job, err error, duration time.Duration, fields []logger.Field) error {
+	fields = append(fields, logger.F(logger.KeyDuration, duration), logger.F(logger.KeyError, err))
+
+	switch {
+	case errors.Is(err, job.ErrRequeue):
+		// the job taken from the queue is kept in the failure backend rather than lost.
+		if rerr := w.Track.requeue(conn, jb); rerr != nil {
+			w.recorder.JobFinished(jb.Queue, jb.Payload.Class, metrics.OutcomeFailure, duration)
+			w.logger.Error("job requeue failed", append(fields, logger.F("requeue_error", rerr))...)
+
+			if err := w.fail(conn, jb, fmt.Errorf("%w: %w", err, rerr)); err != nil {
+				return err
+			}
+
+			return rerr
 		}
+
+		w.recorder.JobFinished(jb.Queue, jb.Payload.Class, metrics.OutcomeRequeued, duration)
+		w.logger.Info("job requeued", fields...)
+
+		return w.Track.count(conn, jb.Queue, stats.Requeued)
+
+	case errors.Is(err, job.ErrDiscard):
+		w.recorder.JobFinished(jb.Queue, jb.Payload.Class, metrics.OutcomeDiscarded, duration)
+		w.logger.Info("job discarded", fields...)
+
+		return w.Track.count(conn, jb.Queue, stats.Discarded)
+
+	default:
+		w.recorder.JobFinished(jb.Queue, jb.Payload.Class, metrics.OutcomeSkipped, duration)
+		w.logger.Debug("job skipped", fields...)
+
+		return w.Track.count(conn, jb.Queue, stats.Skipped)
 	}
+}
 
+func (w *Worker) run(ctx context.Context, jb *job.Job) error {
+	ctx = job.WithWorker(ctx, w.String())
+
+	if w.tracer != nil {
+		_, err := trace.Run(ctx, w.tracer, w.handlers, jb)
+		return err
+	}
+
+	_, err := job.Run(ctx, w.handlers, jb)
 	return err
 }
 
-func (w *Worker) run(ctx context.Context, jb *job.Job) (err error) {
-	var result job.Result
-	handler, ok := w.handlers[jb.Payload.Class]
-	if !ok {
-		return fmt.Errorf("could not find a handler for job class %s", jb.Payload.Class)
+func (w *Worker) jobFields(jb *job.Job) []logger.Field {
+	fields := []logger.Field{
+		logger.F(logger.KeyWorker, w.String()),
+		logger.F(logger.KeyQueue, jb.Queue),
+		logger.F(logger.KeyClass, jb.Payload.Class),
 	}
 
-	for _, plugin := range handler.Plugins() {
-		if err = plugin.BeforePerform(ctx, jb.Queue, jb.Payload.Class, jb.Payload.Args); err != nil {
-			return
-		}
+	if jb.Payload.ID != "" {
+		fields = append(fields, logger.F(logger.KeyJobID, jb.Payload.ID))
 	}
 
-	defer func() {
-		for _, plugin := range handler.Plugins() {
-			if err = plugin.AfterPerform(ctx, jb.Queue, jb.Payload.Class, jb.Payload.Args, result, err); err != nil {
-				return
-			}
-		}
-	}()
+	if jb.Payload.Attempt > 1 {
+		fields = append(fields, logger.F(logger.KeyAttempt, jb.Payload.Attempt))
+	}
 
-	result, err = handler.Perform(ctx, jb.Queue, jb.Payload.Class, jb.Payload.Args)
-	return
+	return fields
 }
 
 func (w *Worker) untrack() error {
 	conn, err := w.pool.Conn()
 	if err != nil {
-		time.Sleep(connCoolDown)
-		return err
+		return redisError(err)
 	}
 	defer conn.Close()
 
-	return w.Track.untrack(conn)
+	if err := w.Track.untrack(conn); err != nil {
+		return redisError(err)
+	}
+
+	return nil
 }
 
 func (w *Worker) track() error {
 	conn, err := w.pool.Conn()
 	if err != nil {
-		time.Sleep(connCoolDown)
-		return err
+		return redisError(err)
 	}
 	defer conn.Close()
 
-	return w.Track.track(conn)
-}
+	if err := w.Track.track(conn); err != nil {
+		return redisError(err)
+	}
 
-func (w *Worker) success(conn db.Conn, _ *job.Job) error {
-	return w.Track.success(conn)
+	return nil
 }
 
-func (w *Worker) fail(conn db.Conn, job *job.Job, err error) error {
-	resqueError := struct {
-		FailedAt  time.Time
-		Payload   json.RawMessage
-		Exception string
-		Error     string
-		Worker    string
-		Queue     string
-	}{
-		FailedAt:  time.Now(),
-		Payload:   job.Payload.Args[0],
-		Exception: "Error",
-		Error:     err.Error(),
-		Worker:    w.String(),
-		Queue:     job.Queue,
+// beatUntil sends the heartbeats until stop is closed. It runs apart from the jobs so that a
+// worker performing a long job is not taken for dead.
+func (w *Worker) beatUntil(stop <-chan struct{}) {
+	ticker := time.NewTicker(w.heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+
+		case <-ticker.C:
+			if err := w.beat(); err != nil {
+				w.reportError("worker heartbeat failed", w.wrapError(nil, err))
+			}
+		}
 	}
+}
 
-	buf, err := json.Marshal(resqueError)
+func (w *Worker) beat() error {
+	conn, err := w.pool.Conn()
 	if err != nil {
-		return fmt.Errorf("marshal failed during %w for job %v", err, job)
+		return redisError(err)
 	}
+	defer conn.Close()
+
+	if err := w.Track.heartbeat(conn); err != nil {
+		return redisError(err)
+	}
+
+	if err := conn.Flush(); err != nil {
+		return redisError(err)
+	}
+
+	return nil
+}
+
+func (w *Worker) wrapError(jb *job.Job, err error) error {
+	e := &Error{Worker: w.String(), Err: err}
+
+	if jb != nil {
+		e.Queue = jb.Queue
+		e.Class = jb.Payload.Class
+	}
+
+	return e
+}
+
+// reportError logs the error of the worker bookkeeping and hands it to the error handler.
+func (w *Worker) reportError(msg string, err error) {
+	w.logger.Error(msg, logger.F(logger.KeyWorker, w.String()), logger.F(logger.KeyError, err))
+	w.errors.HandleError(err)
+}
+
+func (w *Worker) success(conn db.Conn, jb *job.Job) error {
+	return w.Track.success(conn, jb.Queue)
+}
 
-	if err := conn.Send("RPUSH", fmt.Sprintf("%s:failed", w.Namespace), buf); err != nil {
+func (w *Worker) fail(conn db.Conn, jb *job.Job, err error) error {
+	if err := w.failures.Save(conn, failure.New(jb, w.String(), err)); err != nil {
 		return err
 	}
 
-	return w.Track.fail(conn)
+	return w.Track.fail(conn, jb.Queue)
 }
@@ -1,20 +1,29 @@
 package poller_test
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"os"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/snobb/goresq/pkg/db"
 	"github.com/snobb/goresq/pkg/db/mock"
+	"github.com/snobb/goresq/pkg/failure"
 	"github.com/snobb/goresq/pkg/job"
+	"github.com/snobb/goresq/pkg/logger"
+	"github.com/snobb/goresq/pkg/noderesque"
 	"github.com/snobb/goresq/pkg/poller"
+	"github.com/snobb/goresq/pkg/stats"
 
 	"github.com/snobb/goresq/test/assert"
+	"github.com/snobb/goresq/test/fakeredis"
 	"github.com/snobb/goresq/test/helpers"
 )
 
@@ -46,6 +55,15 @@ func TestWorker_Work(t *testing.T) {
 			perform: func(ctx context.Context, queue, class string, args []json.RawMessage) (job.Result, error) {
 				assert.Eq(t, "queue1", queue)
 				assert.Eq(t, "test", class)
+
+				e, ok := job.FromContext(ctx)
+				assert.Eq(t, true, ok)
+				assert.Eq(t, workerID+":queue1,queue2", e.Worker)
+				assert.Eq(t, "queue1", e.Queue)
+				assert.Eq(t, "test", e.Payload.Class)
+				assert.Eq(t, 1, e.Attempt())
+				assert.Eq(t, false, e.StartedAt.IsZero())
+
 				return "foobar", nil
 			},
 			wantCommands: []string{
@@ -53,9 +71,14 @@ func TestWorker_Work(t *testing.T) {
 				fmt.Sprintf("SET resque:stat:processed:%s:queue1,queue2", workerID),
 				fmt.Sprintf("SET resque:stat:failed:%s:queue1,queue2", workerID),
 				fmt.Sprintf("SET resque:worker:%s:queue1,queue2:started", workerID),
+				"HSET resque:workers:heartbeat",
 				"Conn::Close",
+				fmt.Sprintf("SET resque:worker:%s:queue1,queue2", workerID),
+				"Conn::Flush",
+				fmt.Sprintf("DEL resque:worker:%s:queue1,queue2", workerID),
 				"INCR resque:stat:processed",
 				fmt.Sprintf("INCR resque:stat:processed:%s:queue1,queue2", workerID),
+				"INCR resque:stat:queue:queue1:processed",
 				"Conn::Flush",
 				"Conn::Close",
 				"SREM resque:workers",
@@ -63,6 +86,7 @@ func TestWorker_Work(t *testing.T) {
 				fmt.Sprintf("DEL resque:stat:failed:%s:queue1,queue2", workerID),
 				fmt.Sprintf("DEL resque:worker:%s:queue1,queue2", workerID),
 				fmt.Sprintf("DEL resque:worker:%s:queue1,queue2:started", workerID),
+				"HDEL resque:workers:heartbeat",
 				"Conn::Flush",
 				"Conn::Close",
 			},
@@ -88,10 +112,15 @@ func TestWorker_Work(t *testing.T) {
 				fmt.Sprintf("SET resque:stat:processed:%s:queue1,queue2", workerID),
 				fmt.Sprintf("SET resque:stat:failed:%s:queue1,queue2", workerID),
 				fmt.Sprintf("SET resque:worker:%s:queue1,queue2:started", workerID),
+				"HSET resque:workers:heartbeat",
 				"Conn::Close",
+				fmt.Sprintf("SET resque:worker:%s:queue1,queue2", workerID),
+				"Conn::Flush",
+				fmt.Sprintf("DEL resque:worker:%s:queue1,queue2", workerID),
 				"RPUSH resque:failed",
 				"INCR resque:stat:failed",
 				fmt.Sprintf("INCR resque:stat:failed:%s:queue1,queue2", workerID),
+				"INCR resque:stat:queue:queue1:failed",
 				"Conn::Flush",
 				"Conn::Close",
 				"SREM resque:workers",
@@ -99,6 +128,7 @@ func TestWorker_Work(t *testing.T) {
 				fmt.Sprintf("DEL resque:stat:failed:%s:queue1,queue2", workerID),
 				fmt.Sprintf("DEL resque:worker:%s:queue1,queue2", workerID),
 				fmt.Sprintf("DEL resque:worker:%s:queue1,queue2:started", workerID),
+				"HDEL resque:workers:heartbeat",
 				"Conn::Flush",
 				"Conn::Close",
 			},
@@ -168,7 +198,7 @@ func TestWorker_Work(t *testing.T) {
 			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
 			defer cancel()
 			go func() {
-				if err := w.Work(ctx, jobs, &wg, nil); (err != nil) != tt.wantErr {
+				if err := w.Work(ctx, jobs, &wg); (err != nil) != tt.wantErr {
 					t.Errorf("Worker.Work() error = %v, wantErr %v", err, tt.wantErr)
 				}
 			}()
@@ -180,3 +210,488 @@ func TestWorker_Work(t *testing.T) {
 		})
 	}
 }
+
+func TestWorker_WorkTrackingFailure(t *testing.T) {
+	var (
+		mu        sync.Mutex
+		redisCmds []string
+		errs      []error
+	)
+
+	mockedConn := &mock.ConnMock{
+		CloseFunc: func() error { return nil },
+		DoFunc: func(commandName string, args ...interface{}) (interface{}, error) {
+			return nil, nil
+		},
+		FlushFunc: func() error {
+			mu.Lock()
+			defer mu.Unlock()
+
+			// the job tracking fails once the job has been taken from the queue.
+			if last := redisCmds[len(redisCmds)-1]; strings.HasPrefix(last, "SET resque:worker:") &&
+				!strings.HasSuffix(last, ":started") {
+				return fmt.Errorf("db spanner")
+			}
+
+			return nil
+		},
+		SendFunc: func(commandName string, args ...interface{}) error {
+			mu.Lock()
+			defer mu.Unlock()
+
+			redisCmds = append(redisCmds, fmt.Sprintf("%s %s", commandName, args[0]))
+
+			return nil
+		},
+	}
+
+	mockedPool := &mock.PoolerMock{
+		ConnFunc: func() (db.Conn, error) { return mockedConn, nil },
+	}
+
+	var performed bool
+
+	handlers := map[string]job.Handler{
+		"test": job.PerformFunc(func(ctx context.Context, queue, class string, args []json.RawMessage) (job.Result, error) {
+			performed = true
+			return nil, nil
+		}),
+	}
+
+	var buf bytes.Buffer
+
+	w := poller.NewWorker(1, "resque", []string{"queue1"}, handlers, mockedPool,
+		poller.WithErrorHandler(poller.ErrorHandlerFunc(func(err error) { errs = append(errs, err) })),
+		poller.WithLogger(logger.Slog(slog.New(slog.NewJSONHandler(&buf, nil)))))
+
+	jobs := make(chan *job.Job)
+
+	var wg sync.WaitGroup
+	assert.Eq(t, nil, w.Work(context.Background(), jobs, &wg))
+
+	jobs <- &job.Job{Queue: "queue1", Payload: job.Payload{Class: "test"}}
+	close(jobs)
+	wg.Wait()
+
+	assert.Eq(t, true, performed)
+	assert.Eq(t, 1, len(errs))
+	assert.Eq(t, true, errors.Is(errs[0], poller.ErrRedis))
+	assert.Eq(t, true, strings.Contains(buf.String(), `"msg":"job tracking failed"`))
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	assert.Eq(t, true, strings.Contains(strings.Join(redisCmds, ","), "INCR resque:stat:queue:queue1:processed"))
+}
+
+func TestWorker_WorkHeartbeatDuringJob(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		beats int
+	)
+
+	mockedConn := &mock.ConnMock{
+		CloseFunc: func() error { return nil },
+		DoFunc: func(commandName string, args ...interface{}) (interface{}, error) {
+			return nil, nil
+		},
+		FlushFunc: func() error { return nil },
+		SendFunc: func(commandName string, args ...interface{}) error {
+			mu.Lock()
+			defer mu.Unlock()
+
+			if commandName == "HSET" {
+				beats++
+			}
+
+			return nil
+		},
+	}
+
+	mockedPool := &mock.PoolerMock{
+		ConnFunc: func() (db.Conn, error) { return mockedConn, nil },
+	}
+
+	count := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return beats
+	}
+
+	var during int
+
+	handlers := map[string]job.Handler{
+		"slow": job.PerformFunc(func(ctx context.Context, queue, class string, args []json.RawMessage) (job.Result, error) {
+			before := count()
+			time.Sleep(50 * time.Millisecond)
+			during = count() - before
+
+			return nil, nil
+		}),
+	}
+
+	w := poller.NewWorker(1, "resque", []string{"queue1"}, handlers, mockedPool,
+		poller.WithHeartbeat(5*time.Millisecond))
+
+	jobs := make(chan *job.Job)
+
+	var wg sync.WaitGroup
+	assert.Eq(t, nil, w.Work(context.Background(), jobs, &wg))
+
+	jobs <- &job.Job{Queue: "queue1", Payload: job.Payload{Class: "slow"}}
+	close(jobs)
+	wg.Wait()
+
+	// the heartbeats go on while the job runs longer than the heartbeat interval.
+	assert.Eq(t, true, during >= 2)
+}
+
+func TestWorker_WorkNodeResque(t *testing.T) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		t.Errorf("could get the hostname: %s", err.Error())
+	}
+	pingKey := fmt.Sprintf("resque:worker:ping:%s:%d-worker1", hostname, os.Getpid())
+	jobKey := fmt.Sprintf("resque:worker:%s:%d-worker1", hostname, os.Getpid())
+
+	rds := fakeredis.New()
+
+	var working string
+
+	handlers := map[string]job.Handler{
+		"test": job.PerformFunc(func(ctx context.Context, queue, class string, args []json.RawMessage) (job.Result, error) {
+			working, _ = rds.Get(jobKey)
+			return nil, nil
+		}),
+	}
+
+	w := poller.NewWorker(1, "resque", []string{"queue1", "queue2"}, handlers, rds.Pool(), poller.WithNodeResque())
+
+	jobs := make(chan *job.Job)
+
+	var wg sync.WaitGroup
+	assert.Eq(t, nil, w.Work(context.Background(), jobs, &wg))
+
+	buf, ok := rds.Get(pingKey)
+	assert.Eq(t, true, ok)
+
+	var ping noderesque.Ping
+	assert.Eq(t, nil, json.Unmarshal([]byte(buf), &ping))
+	assert.Eq(t, fmt.Sprintf("%s:%d-worker1", hostname, os.Getpid()), ping.Name)
+	assert.Eq(t, "queue1,queue2", ping.Queues)
+	assert.Eq(t, true, time.Since(time.Unix(ping.Time, 0)) < time.Minute)
+
+	jobs <- &job.Job{Queue: "queue1", Payload: job.Payload{Class: "test"}}
+	close(jobs)
+	wg.Wait()
+
+	// the job is mirrored under the worker name while it runs, as node-resque records it.
+	var record struct {
+		Queue   string      `json:"queue"`
+		Payload job.Payload `json:"payload"`
+	}
+	assert.Eq(t, nil, json.Unmarshal([]byte(working), &record))
+	assert.Eq(t, "queue1", record.Queue)
+	assert.Eq(t, "test", record.Payload.Class)
+
+	_, ok = rds.Get(pingKey)
+	assert.Eq(t, false, ok)
+
+	_, ok = rds.Get(jobKey)
+	assert.Eq(t, false, ok)
+}
+
+type failurePlugin struct {
+	mu       sync.Mutex
+	before   error
+	after    error
+	afters   int
+	failures []string
+}
+
+func (p *failurePlugin) BeforePerform(_ context.Context, _, _ string, _ []json.RawMessage) error {
+	return p.before
+}
+
+func (p *failurePlugin) AfterPerform(_ context.Context, _, _ string, _ []json.RawMessage, _ job.Result, err error) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.afters++
+
+	if p.after != nil {
+		return p.after
+	}
+
+	return err
+}
+
+func (p *failurePlugin) OnFailure(_ context.Context, queue, class string, _ []json.RawMessage, err error) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.failures = append(p.failures, fmt.Sprintf("%s %s: %v", queue, class, err))
+
+	return nil
+}
+
+type failingHandler struct {
+	plugin *failurePlugin
+	err    error
+}
+
+func (h *failingHandler) Plugins() []job.Plugin {
+	return []job.Plugin{h.plugin}
+}
+
+func (h *failingHandler) Perform(_ context.Context, _, class string, _ []json.RawMessage) (job.Result, error) {
+	if h.err != nil {
+		return nil, h.err
+	}
+
+	if class == "fail" {
+		return nil, fmt.Errorf("spanner")
+	}
+
+	return nil, nil
+}
+
+func TestWorker_WorkFailure(t *testing.T) {
+	tests := []struct {
+		name         string
+		class        string
+		before       error
+		backend      func(rds *fakeredis.Redis) failure.Backend
+		wantFailures string
+		wantLists    map[string]int
+	}{
+		{
+			name:      "success",
+			class:     "ok",
+			wantLists: map[string]int{"resque:failed": 0},
+		},
+		{
+			name:         "default backend",
+			class:        "fail",
+			wantFailures: "queue1 fail: spanner",
+			wantLists:    map[string]int{"resque:failed": 1},
+		},
+		{
+			name:         "failing before perform plugin",
+			class:        "ok",
+			before:       fmt.Errorf("locked"),
+			wantFailures: "queue1 ok: plugin failed: *poller_test.failurePlugin: locked",
+			wantLists:    map[string]int{"resque:failed": 1},
+		},
+		{
+			name:  "per-queue and single list backends",
+			class: "fail",
+			backend: func(rds *fakeredis.Redis) failure.Backend {
+				return failure.Multi{failure.NewPerQueue("resque"), failure.NewRedis(rds.Pool())}
+			},
+			wantFailures: "queue1 fail: spanner",
+			wantLists:    map[string]int{"resque:failed": 1, "resque:queue1_failed": 1},
+		},
+		{
+			name:  "no-op backend",
+			class: "fail",
+			backend: func(*fakeredis.Redis) failure.Backend {
+				return failure.Nop{}
+			},
+			wantFailures: "queue1 fail: spanner",
+			wantLists:    map[string]int{"resque:failed": 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rds := fakeredis.New()
+			plugin := &failurePlugin{before: tt.before}
+			handlers := map[string]job.Handler{tt.class: &failingHandler{plugin: plugin}}
+
+			var opts []poller.Option
+			if tt.backend != nil {
+				opts = append(opts, poller.WithFailureBackend(tt.backend(rds)))
+			}
+
+			w := poller.NewWorker(1, "resque", []string{"queue1"}, handlers, rds.Pool(), opts...)
+
+			jobs := make(chan *job.Job)
+
+			var wg sync.WaitGroup
+			assert.Eq(t, nil, w.Work(context.Background(), jobs, &wg))
+
+			jobs <- &job.Job{Queue: "queue1", Payload: job.Payload{Class: tt.class}}
+			close(jobs)
+			wg.Wait()
+
+			assert.Eq(t, tt.wantFailures, strings.Join(plugin.failures, "\n"))
+
+			for key, want := range tt.wantLists {
+				assert.Eq(t, want, len(rds.List(key)))
+			}
+
+			if tt.wantLists["resque:queue1_failed"] > 0 {
+				assert.Eq(t, "queue1_failed", strings.Join(rds.Members("resque:failed_queues"), ","))
+			}
+		})
+	}
+}
+
+func TestWorker_WorkAborted(t *testing.T) {
+	tests := []struct {
+		name       string
+		before     error
+		perform    error
+		after      error
+		wantCounts stats.Counts
+		wantQueue  int
+	}{
+		{
+			name:       "skip before perform",
+			before:     job.ErrSkip,
+			wantCounts: stats.Counts{Skipped: 1},
+		},
+		{
+			name:       "requeue before perform",
+			before:     fmt.Errorf("locked: %w", job.ErrRequeue),
+			wantCounts: stats.Counts{Requeued: 1},
+			wantQueue:  1,
+		},
+		{
+			name:       "discard before perform",
+			before:     job.ErrDiscard,
+			wantCounts: stats.Counts{Discarded: 1},
+		},
+		{
+			name:       "skip in perform",
+			perform:    job.ErrSkip,
+			wantCounts: stats.Counts{Skipped: 1},
+		},
+		{
+			name:       "requeue in perform",
+			perform:    job.ErrRequeue,
+			wantCounts: stats.Counts{Requeued: 1},
+			wantQueue:  1,
+		},
+		{
+			name:       "discard in perform",
+			perform:    fmt.Errorf("stale: %w", job.ErrDiscard),
+			wantCounts: stats.Counts{Discarded: 1},
+		},
+		{
+			name:       "failing after perform plugin is skipped",
+			perform:    job.ErrSkip,
+			after:      fmt.Errorf("spanner"),
+			wantCounts: stats.Counts{Skipped: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rds := fakeredis.New()
+			plugin := &failurePlugin{before: tt.before, after: tt.after}
+			handlers := map[string]job.Handler{"fail": &failingHandler{plugin: plugin, err: tt.perform}}
+
+			var errs []error
+
+			w := poller.NewWorker(1, "resque", []string{"queue1"}, handlers, rds.Pool(),
+				poller.WithErrorHandler(poller.ErrorHandlerFunc(func(err error) { errs = append(errs, err) })))
+
+			jobs := make(chan *job.Job)
+
+			var wg sync.WaitGroup
+			assert.Eq(t, nil, w.Work(context.Background(), jobs, &wg))
+
+			jobs <- &job.Job{Queue: "queue1", Payload: job.Payload{Class: "fail", ID: "42"}}
+			close(jobs)
+			wg.Wait()
+
+			assert.Eq(t, 0, len(errs))
+			assert.Eq(t, 0, plugin.afters)
+			assert.Eq(t, "", strings.Join(plugin.failures, "\n"))
+			assert.Eq(t, 0, len(rds.List("resque:failed")))
+
+			queue := rds.List("resque:queue:queue1")
+			assert.Eq(t, tt.wantQueue, len(queue))
+
+			if tt.wantQueue > 0 {
+				assert.Eq(t, `{"class":"fail","args":null,"id":"42"}`, queue[0])
+			}
+
+			st := stats.New(rds.Pool())
+
+			total, err := st.Total()
+			assert.Eq(t, nil, err)
+			assert.Eq(t, tt.wantCounts, total)
+
+			counts, err := st.Queue("queue1")
+			assert.Eq(t, nil, err)
+			assert.Eq(t, tt.wantCounts, counts)
+		})
+	}
+}
+
+func TestWorker_WorkRequeueFailed(t *testing.T) {
+	rds := fakeredis.New()
+
+	// the job can not be pushed back to its queue.
+	mockedPool := &mock.PoolerMock{
+		ConnFunc: func() (db.Conn, error) {
+			conn, err := rds.Pool().Conn()
+			if err != nil {
+				return nil, err
+			}
+
+			return &mock.ConnMock{
+				CloseFunc: conn.Close,
+				ErrFunc:   conn.Err,
+				FlushFunc: conn.Flush,
+				SendFunc:  conn.Send,
+				DoFunc: func(commandName string, args ...interface{}) (interface{}, error) {
+					if commandName == "RPUSH" && args[0] == "resque:queue:queue1" {
+						return nil, fmt.Errorf("db spanner")
+					}
+
+					return conn.Do(commandName, args...)
+				},
+			}, nil
+		},
+	}
+
+	plugin := &failurePlugin{}
+	handlers := map[string]job.Handler{"fail": &failingHandler{plugin: plugin, err: job.ErrRequeue}}
+
+	var errs []error
+
+	w := poller.NewWorker(1, "resque", []string{"queue1"}, handlers, mockedPool,
+		poller.WithErrorHandler(poller.ErrorHandlerFunc(func(err error) { errs = append(errs, err) })))
+
+	jobs := make(chan *job.Job)
+
+	var wg sync.WaitGroup
+	assert.Eq(t, nil, w.Work(context.Background(), jobs, &wg))
+
+	jobs <- &job.Job{Queue: "queue1", Payload: job.Payload{Class: "fail", ID: "42"}}
+	close(jobs)
+	wg.Wait()
+
+	assert.Eq(t, 1, len(errs))
+	assert.Eq(t, true, errors.Is(errs[0], poller.ErrRedis))
+
+	// the job is kept in the failure backend rather than lost.
+	assert.Eq(t, 0, len(rds.List("resque:queue:queue1")))
+
+	failed := rds.List("resque:failed")
+	assert.Eq(t, 1, len(failed))
+
+	var f failure.Failure
+	assert.Eq(t, nil, json.Unmarshal([]byte(failed[0]), &f))
+	assert.Eq(t, "fail", f.Payload.Class)
+	assert.Eq(t, "42", f.Payload.ID)
+
+	total, err := stats.New(rds.Pool()).Total()
+	assert.Eq(t, nil, err)
+	assert.Eq(t, stats.Counts{Failed: 1}, total)
+}
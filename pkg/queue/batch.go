@@ -0,0 +1,254 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/gomodule/redigo/redis"
+
+	"github.com/snobb/goresq/pkg/logger"
+	"github.com/snobb/goresq/pkg/trace"
+)
+
+// ErrAborted is returned when the atomic batch transaction has been aborted by redis.
+var ErrAborted = errors.New("batch transaction aborted")
+
+// Job is a job to enqueue with EnqueueBatch, or the job being enqueued as seen by a JobPlugin.
+type Job struct {
+	Queue string
+	Class string
+	Args  []interface{}
+	// Metadata are added to the metadata carried by the context, see WithMetadata.
+	Metadata map[string]string
+}
+
+type batchOptions struct {
+	atomic bool
+}
+
+// BatchOption configures EnqueueBatch.
+type BatchOption func(*batchOptions)
+
+// Atomic wraps the batch in MULTI/EXEC so that it runs as one unit, without the commands of
+// other clients in between. Redis does not roll back a transaction: a command failing inside
+// it, e.g. with a WRONGTYPE error on one queue, leaves the others applied and the failure is
+// reported the same way as for a batch that is not atomic.
+func Atomic() BatchOption {
+	return func(o *batchOptions) {
+		o.atomic = true
+	}
+}
+
+// EnqueueBatch enqueues the jobs over a single pipelined connection with a single RPUSH per
+// queue and returns the results in the order of the jobs. The plugins are run for each job:
+// PrepareEnqueue and BeforeEnqueue for all the jobs before anything is written, so that a
+// failing plugin cancels the whole batch, and AfterEnqueue once redis has acknowledged the
+// writes. When redis refuses the jobs of some queues, the jobs of the other queues are still
+// accounted and their results returned, with a zero Length for the refused jobs, along with
+// the joined errors.
+func (q *Queue) EnqueueBatch(ctx context.Context, jobs []Job, opts ...BatchOption) (res []EnqueueResult, err error) {
+	if len(jobs) == 0 {
+		return []EnqueueResult{}, nil
+	}
+
+	var o batchOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if q.tracer != nil {
+		var span trace.Span
+		ctx, span = q.tracer.Start(ctx, trace.SpanEnqueueBatch,
+			trace.Attribute{Key: "goresq.jobs", Value: strconv.Itoa(len(jobs))})
+		defer func() { span.End(err) }()
+	}
+
+	// the plugins may rewrite the jobs, the jobs of the caller are left untouched.
+	jobs = append([]Job(nil), jobs...)
+
+	res = make([]EnqueueResult, len(jobs))
+	for i, jb := range jobs {
+		res[i] = EnqueueResult{ID: q.newID(), Queue: jb.Queue}
+	}
+
+	if q.handlers != nil {
+		var errs []error
+
+		for i := range jobs {
+			if err := q.perform(ctx, res[i].ID, &jobs[i]); err != nil {
+				errs = append(errs, err)
+			}
+
+			res[i].Queue = jobs[i].Queue
+		}
+
+		return res, errors.Join(errs...)
+	}
+
+	conn, err := q.pool.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var queues []string
+
+	items := map[string][]interface{}{}
+	contexts := make([]context.Context, len(jobs))
+
+	for i := range jobs {
+		jb := &jobs[i]
+
+		if contexts[i], err = q.prepare(ctx, jb); err != nil {
+			return nil, err
+		}
+
+		res[i].Queue = jb.Queue
+
+		buf, err := q.encode(contexts[i], res[i].ID, jb.Class, jb.Args)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := items[jb.Queue]; !ok {
+			queues = append(queues, jb.Queue)
+		}
+
+		items[jb.Queue] = append(items[jb.Queue], buf)
+	}
+
+	var sent int
+
+	send := func(commandName string, args ...interface{}) error {
+		sent++
+		return conn.Send(commandName, args...)
+	}
+
+	if o.atomic {
+		if err := send("MULTI"); err != nil {
+			return nil, err
+		}
+	}
+
+	registered := []interface{}{fmt.Sprintf("%s:queues", q.Namespace)}
+
+	for _, queue := range queues {
+		if err := send("RPUSH", append([]interface{}{q.key(queue)}, items[queue]...)...); err != nil {
+			return nil, err
+		}
+
+		registered = append(registered, queue)
+	}
+
+	if err := send("SADD", registered...); err != nil {
+		return nil, err
+	}
+
+	if o.atomic {
+		if err := send("EXEC"); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := conn.Flush(); err != nil {
+		return nil, err
+	}
+
+	// all the replies are read even after an error so that the connection can be reused.
+	replies := make([]interface{}, sent)
+	replyErrs := make([]error, sent)
+
+	for i := range replies {
+		replies[i], replyErrs[i] = conn.Receive()
+	}
+
+	if o.atomic {
+		// an error before EXEC aborts the transaction, nothing has been written.
+		if err := errors.Join(replyErrs...); err != nil {
+			return nil, err
+		}
+
+		if replies, err = execReplies(replies[sent-1]); err != nil {
+			return nil, err
+		}
+
+		replyErrs = make([]error, len(replies))
+		for i, reply := range replies {
+			if rerr, ok := reply.(redis.Error); ok {
+				replies[i], replyErrs[i] = nil, rerr
+			}
+		}
+	}
+
+	var errs []error
+
+	// the jobs of a queue redis has refused are left out, the others are still accounted.
+	enqueued := make(map[string]bool, len(queues))
+
+	// the reply to RPUSH is the length of the queue after the last job of the queue has been
+	// pushed.
+	for i, queue := range queues {
+		length, err := redis.Int(replies[i], replyErrs[i])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("enqueue to %s: %w", queue, err))
+			continue
+		}
+
+		enqueued[queue] = true
+
+		for j := len(jobs) - 1; j >= 0; j-- {
+			if jobs[j].Queue == queue {
+				res[j].Length = length
+				length--
+			}
+		}
+	}
+
+	// the jobs have been pushed even if the queues could not be registered.
+	if err := replyErrs[len(queues)]; err != nil {
+		errs = append(errs, fmt.Errorf("register queues: %w", err))
+	}
+
+	if len(enqueued) == 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	var n int
+
+	for _, jb := range jobs {
+		if enqueued[jb.Queue] {
+			q.recorder.JobEnqueued(jb.Queue, jb.Class)
+			n++
+		}
+	}
+
+	q.logger.Debug("jobs enqueued", logger.F("jobs", n), logger.F(logger.KeyQueues, queues))
+
+	for i, jb := range jobs {
+		if !enqueued[jb.Queue] {
+			continue
+		}
+
+		if err := q.afterEnqueue(contexts[i], jb); err != nil {
+			return res, errors.Join(append(errs, err)...)
+		}
+	}
+
+	return res, errors.Join(errs...)
+}
+
+// execReplies returns the replies to the commands of the transaction.
+func execReplies(reply interface{}) ([]interface{}, error) {
+	if reply == nil {
+		return nil, ErrAborted
+	}
+
+	replies, ok := reply.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: unexpected reply %v", ErrAborted, reply)
+	}
+
+	return replies, nil
+}
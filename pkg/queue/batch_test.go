@@ -0,0 +1,231 @@
+package queue_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+
+	"github.com/snobb/goresq/pkg/db"
+	"github.com/snobb/goresq/pkg/db/mock"
+	"github.com/snobb/goresq/pkg/job"
+	"github.com/snobb/goresq/pkg/queue"
+	"github.com/snobb/goresq/test/assert"
+)
+
+func TestQueue_EnqueueBatch(t *testing.T) {
+	jobs := []queue.Job{
+		{Queue: "mail", Class: "Mail", Args: []interface{}{1}},
+		{Queue: "sms", Class: "Sms", Args: []interface{}{2}},
+		{Queue: "mail", Class: "Mail", Args: []interface{}{3}},
+	}
+
+	tests := []struct {
+		name            string
+		opts            []queue.BatchOption
+		beforeErrAt     int
+		replyErrAt      int
+		execReply       interface{}
+		wantRedisCmds   []string
+		wantBeforeCalls int
+		wantAfterCalls  int
+		wantLengths     string
+		wantErrIs       error
+		wantErr         bool
+	}{
+		{
+			name: "should pipeline a single RPUSH per queue",
+			wantRedisCmds: []string{
+				`RPUSH resque:queue:mail {"class":"Mail","args":[1],"id":"job","enqueued_at":1700000000,"attempt":1} {"class":"Mail","args":[3],"id":"job","enqueued_at":1700000000,"attempt":1}`,
+				`RPUSH resque:queue:sms {"class":"Sms","args":[2],"id":"job","enqueued_at":1700000000,"attempt":1}`,
+				"SADD resque:queues mail sms",
+				"Conn::Flush",
+			},
+			wantBeforeCalls: 3,
+			wantAfterCalls:  3,
+		},
+		{
+			name: "should wrap the batch in a transaction",
+			opts: []queue.BatchOption{queue.Atomic()},
+			wantRedisCmds: []string{
+				"MULTI",
+				`RPUSH resque:queue:mail {"class":"Mail","args":[1],"id":"job","enqueued_at":1700000000,"attempt":1} {"class":"Mail","args":[3],"id":"job","enqueued_at":1700000000,"attempt":1}`,
+				`RPUSH resque:queue:sms {"class":"Sms","args":[2],"id":"job","enqueued_at":1700000000,"attempt":1}`,
+				"SADD resque:queues mail sms",
+				"EXEC",
+				"Conn::Flush",
+			},
+			execReply:       []interface{}{int64(2), int64(1), int64(2)},
+			wantBeforeCalls: 3,
+			wantAfterCalls:  3,
+		},
+		{
+			name:            "should account the applied commands if a command of the transaction fails",
+			opts:            []queue.BatchOption{queue.Atomic()},
+			execReply:       []interface{}{int64(2), redis.Error("WRONGTYPE"), int64(2)},
+			wantBeforeCalls: 3,
+			wantAfterCalls:  2,
+			wantLengths:     "1,0,2",
+			wantErr:         true,
+		},
+		{
+			name:            "should fail if the transaction is discarded",
+			opts:            []queue.BatchOption{queue.Atomic()},
+			wantBeforeCalls: 3,
+			wantErrIs:       queue.ErrAborted,
+			wantErr:         true,
+		},
+		{
+			name:            "should account the jobs of the other queues if a write fails",
+			replyErrAt:      2,
+			wantBeforeCalls: 3,
+			wantAfterCalls:  2,
+			wantLengths:     "1,0,2",
+			wantErr:         true,
+		},
+		{
+			name:            "should account the jobs if the queues registration fails",
+			replyErrAt:      3,
+			wantBeforeCalls: 3,
+			wantAfterCalls:  3,
+			wantLengths:     "1,1,2",
+			wantErr:         true,
+		},
+		{
+			name:            "should not write anything if a before plugin fails",
+			beforeErrAt:     2,
+			wantBeforeCalls: 2,
+			wantErr:         true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var redisCmds []string
+
+			received := 0
+			mockedConn := &mock.ConnMock{
+				CloseFunc: func() error {
+					return nil
+				},
+				FlushFunc: func() error {
+					redisCmds = append(redisCmds, "Conn::Flush")
+					return nil
+				},
+				ReceiveFunc: func() (interface{}, error) {
+					received++
+					if received == tt.replyErrAt {
+						return nil, redis.Error("ERR spanner")
+					}
+
+					if received == len(redisCmds)-1 && len(tt.opts) > 0 {
+						return tt.execReply, nil
+					}
+
+					// the lengths of the mail and sms queues and the number of the added queues.
+					return []interface{}{int64(2), int64(1), int64(2)}[min(received, 3)-1], nil
+				},
+				SendFunc: func(commandName string, args ...interface{}) error {
+					cmd := []string{commandName}
+					for _, arg := range args {
+						cmd = append(cmd, fmt.Sprintf("%s", arg))
+					}
+
+					redisCmds = append(redisCmds, strings.Join(cmd, " "))
+					return nil
+				},
+			}
+
+			mockedPool := &mock.PoolerMock{
+				ConnFunc: func() (db.Conn, error) {
+					return mockedConn, nil
+				},
+			}
+
+			p := &plugin{
+				afterFunc: func(_ context.Context, _, _ string, _ []interface{}) error {
+					return nil
+				},
+			}
+			p.beforeFunc = func(_ context.Context, _, _ string, _ []interface{}) error {
+				if p.beforeCount == tt.beforeErrAt {
+					return fmt.Errorf("spanner")
+				}
+				return nil
+			}
+
+			q := queue.New(mockedPool)
+			queue.SetNow(q, func() time.Time { return time.Unix(1700000000, 0) })
+			queue.SetNewID(q, func() string { return "job" })
+			q.RegisterPlugins(p)
+
+			res, err := q.EnqueueBatch(context.Background(), jobs, tt.opts...)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Queue.EnqueueBatch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErrIs != nil {
+				assert.Eq(t, true, errors.Is(err, tt.wantErrIs))
+			}
+
+			if tt.beforeErrAt > 0 {
+				assert.Eq(t, 0, len(redisCmds))
+			}
+
+			assert.Eq(t, tt.wantBeforeCalls, p.beforeCount)
+			assert.Eq(t, tt.wantAfterCalls, p.afterCount)
+
+			if !tt.wantErr {
+				assert.Eq(t, 3, len(res))
+				assert.Eq(t, queue.EnqueueResult{ID: "job", Queue: "mail", Length: 1}, res[0])
+				assert.Eq(t, queue.EnqueueResult{ID: "job", Queue: "sms", Length: 1}, res[1])
+				assert.Eq(t, queue.EnqueueResult{ID: "job", Queue: "mail", Length: 2}, res[2])
+			}
+
+			if tt.wantLengths != "" {
+				var lengths []string
+				for _, r := range res {
+					lengths = append(lengths, fmt.Sprint(r.Length))
+				}
+
+				assert.Eq(t, tt.wantLengths, strings.Join(lengths, ","))
+			}
+
+			if tt.wantRedisCmds != nil {
+				assert.Eq(t, strings.Join(tt.wantRedisCmds, "\n"), strings.Join(redisCmds, "\n"))
+			}
+		})
+	}
+}
+
+func TestQueue_EnqueueBatchInline(t *testing.T) {
+	var performed []string
+
+	handlers := map[string]job.Handler{
+		"Mail": job.PerformFunc(func(_ context.Context, queue, _ string, args []json.RawMessage) (job.Result, error) {
+			performed = append(performed, queue+string(args[0]))
+			if string(args[0]) == "2" {
+				return nil, fmt.Errorf("spanner")
+			}
+
+			return nil, nil
+		}),
+	}
+
+	q := queue.New(nil, queue.Inline(handlers))
+
+	res, err := q.EnqueueBatch(context.Background(), []queue.Job{
+		{Queue: "a", Class: "Mail", Args: []interface{}{1}},
+		{Queue: "b", Class: "Mail", Args: []interface{}{2}},
+		{Queue: "c", Class: "Mail", Args: []interface{}{3}},
+	})
+
+	assert.Eq(t, "spanner", fmt.Sprint(err))
+	assert.Eq(t, "a1,b2,c3", strings.Join(performed, ","))
+	assert.Eq(t, 3, len(res))
+}
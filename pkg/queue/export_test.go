@@ -0,0 +1,13 @@
+package queue
+
+import "time"
+
+// SetNow replaces the clock used to timestamp the enqueued jobs.
+func SetNow(q *Queue, now func() time.Time) {
+	q.now = now
+}
+
+// SetNewID replaces the generator of the job ids.
+func SetNewID(q *Queue, newID func() string) {
+	q.newID = newID
+}
@@ -0,0 +1,190 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/gomodule/redigo/redis"
+
+	"github.com/snobb/goresq/pkg/job"
+	"github.com/snobb/goresq/pkg/logger"
+)
+
+func (q *Queue) key(queue string) string {
+	return fmt.Sprintf("%s:queue:%s", q.Namespace, queue)
+}
+
+// Queues returns the names of the registered queues sorted by name.
+func (q *Queue) Queues() ([]string, error) {
+	conn, err := q.pool.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	names, err := redis.Strings(conn.Do("SMEMBERS", fmt.Sprintf("%s:queues", q.Namespace)))
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// Size returns the number of the jobs in the queue.
+func (q *Queue) Size(queue string) (int, error) {
+	conn, err := q.pool.Conn()
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	return redis.Int(conn.Do("LLEN", q.key(queue)))
+}
+
+// Peek returns count jobs of the queue starting at the given index without removing them.
+func (q *Queue) Peek(queue string, start, count int) ([]job.Payload, error) {
+	if count <= 0 {
+		return []job.Payload{}, nil
+	}
+
+	conn, err := q.pool.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	items, err := redis.ByteSlices(conn.Do("LRANGE", q.key(queue), start, start+count-1))
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := make([]job.Payload, 0, len(items))
+
+	for _, item := range items {
+		var payload job.Payload
+		if err := json.Unmarshal(item, &payload); err != nil {
+			return nil, err
+		}
+
+		jobs = append(jobs, payload)
+	}
+
+	return jobs, nil
+}
+
+// RemoveQueue deletes the queue with all its jobs and unregisters it from the queues set.
+func (q *Queue) RemoveQueue(queue string) error {
+	conn, err := q.pool.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.Do("DEL", q.key(queue)); err != nil {
+		return err
+	}
+
+	_, err = conn.Do("SREM", fmt.Sprintf("%s:queues", q.Namespace), queue)
+
+	return err
+}
+
+// Dequeue removes the jobs of the class from the queue and returns the number of the removed
+// jobs. If args are given only the jobs with the same arguments are removed, the same way
+// Resque.dequeue does. The arguments are compared as JSON. The DequeuePlugins are run before
+// and after the removal; nothing is removed if a BeforeDequeue plugin fails.
+func (q *Queue) Dequeue(ctx context.Context, queue, class string, args ...interface{}) (int, error) {
+	want, err := decodeArgs(args)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, plugin := range q.plugins {
+		if p, ok := plugin.(DequeuePlugin); ok {
+			if err := p.BeforeDequeue(ctx, queue, class, args); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	conn, err := q.pool.Conn()
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	items, err := redis.Strings(conn.Do("LRANGE", q.key(queue), 0, -1))
+	if err != nil {
+		return 0, err
+	}
+
+	matched := map[string]struct{}{}
+
+	for _, item := range items {
+		var payload job.Payload
+		if err := json.Unmarshal([]byte(item), &payload); err != nil || payload.Class != class {
+			continue
+		}
+
+		if len(args) > 0 {
+			got := make([]interface{}, len(payload.Args))
+			for i, arg := range payload.Args {
+				got[i] = arg
+			}
+
+			if got, err := decodeArgs(got); err != nil || !reflect.DeepEqual(got, want) {
+				continue
+			}
+		}
+
+		matched[item] = struct{}{}
+	}
+
+	var removed int
+
+	for item := range matched {
+		n, err := redis.Int(conn.Do("LREM", q.key(queue), 0, item))
+		if err != nil {
+			return removed, err
+		}
+
+		removed += n
+	}
+
+	q.logger.Debug("jobs dequeued", logger.F(logger.KeyQueue, queue), logger.F(logger.KeyClass, class),
+		logger.F("removed", removed))
+
+	for _, plugin := range q.plugins {
+		if p, ok := plugin.(DequeuePlugin); ok {
+			if err := p.AfterDequeue(ctx, queue, class, args); err != nil {
+				return removed, err
+			}
+		}
+	}
+
+	return removed, nil
+}
+
+// decodeArgs returns the job arguments decoded from JSON so that they are compared by value, the
+// way Resque does, regardless of the key order and the number formatting of the producer.
+func decodeArgs(args []interface{}) ([]interface{}, error) {
+	res := make([]interface{}, len(args))
+
+	for i, arg := range args {
+		raw, err := json.Marshal(arg)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := json.Unmarshal(raw, &res[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return res, nil
+}
@@ -0,0 +1,213 @@
+package queue_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/snobb/goresq/pkg/job"
+	"github.com/snobb/goresq/pkg/queue"
+
+	"github.com/snobb/goresq/test/assert"
+	"github.com/snobb/goresq/test/fakeredis"
+)
+
+func seedQueues(t *testing.T) *fakeredis.Redis {
+	t.Helper()
+
+	rds := fakeredis.New()
+
+	rds.Seed(t, [][]interface{}{
+		{"SADD", "resque:queues", "mail", "default"},
+		{"RPUSH", "resque:queue:mail", `{"class":"Mail","args":[{"id":1}]}`, `{"class":"Mail","args":[{"id":2}]}`,
+			`{"class":"Sms","args":["a",1]}`, `{"class":"Mail","args":[{"id":1}]}`},
+	}...)
+
+	return rds
+}
+
+func TestQueue_Inspect(t *testing.T) {
+	rds := seedQueues(t)
+	q := queue.New(rds.Pool())
+
+	names, err := q.Queues()
+	assert.Eq(t, nil, err)
+	assert.Eq(t, "default,mail", strings.Join(names, ","))
+
+	size, err := q.Size("mail")
+	assert.Eq(t, nil, err)
+	assert.Eq(t, 4, size)
+
+	size, err = q.Size("default")
+	assert.Eq(t, nil, err)
+	assert.Eq(t, 0, size)
+
+	jobs, err := q.Peek("mail", 1, 2)
+	assert.Eq(t, nil, err)
+	assert.Eq(t, 2, len(jobs))
+	assert.Eq(t, "Mail", jobs[0].Class)
+	assert.Eq(t, `{"id":2}`, string(jobs[0].Args[0]))
+	assert.Eq(t, "Sms", jobs[1].Class)
+
+	jobs, err = q.Peek("mail", 0, 0)
+	assert.Eq(t, nil, err)
+	assert.Eq(t, 0, len(jobs))
+}
+
+func TestQueue_RemoveQueue(t *testing.T) {
+	rds := seedQueues(t)
+	q := queue.New(rds.Pool())
+
+	assert.Eq(t, nil, q.RemoveQueue("mail"))
+	assert.Eq(t, 0, len(rds.List("resque:queue:mail")))
+	assert.Eq(t, "default", strings.Join(rds.Members("resque:queues"), ","))
+}
+
+func TestQueue_Dequeue(t *testing.T) {
+	tests := []struct {
+		name      string
+		class     string
+		args      []interface{}
+		wantCount int
+		wantLeft  []string
+	}{
+		{
+			name:      "by class",
+			class:     "Mail",
+			wantCount: 3,
+			wantLeft:  []string{"Sms"},
+		},
+		{
+			name:      "by class and args",
+			class:     "Mail",
+			args:      []interface{}{map[string]int{"id": 1}},
+			wantCount: 2,
+			wantLeft:  []string{"Mail", "Sms"},
+		},
+		{
+			name:      "by class and raw args",
+			class:     "Sms",
+			args:      []interface{}{"a", json.RawMessage(` 1 `)},
+			wantCount: 1,
+			wantLeft:  []string{"Mail", "Mail", "Mail"},
+		},
+		{
+			name:     "args do not match",
+			class:    "Sms",
+			args:     []interface{}{"a"},
+			wantLeft: []string{"Mail", "Mail", "Sms", "Mail"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rds := seedQueues(t)
+
+			n, err := queue.New(rds.Pool()).Dequeue(context.Background(), "mail", tt.class, tt.args...)
+			assert.Eq(t, nil, err)
+			assert.Eq(t, tt.wantCount, n)
+
+			var left []string
+			for _, item := range rds.List("resque:queue:mail") {
+				var payload job.Payload
+				if err := json.Unmarshal([]byte(item), &payload); err != nil {
+					t.Fatal(err)
+				}
+
+				left = append(left, payload.Class)
+			}
+
+			assert.Eq(t, strings.Join(tt.wantLeft, ","), strings.Join(left, ","))
+		})
+	}
+}
+
+func TestQueue_DequeueDecodedArgs(t *testing.T) {
+	rds := fakeredis.New()
+	rds.Seed(t, [][]interface{}{
+		// enqueued by other producers with their own key order and number formatting.
+		{"RPUSH", "resque:queue:mail", `{"class":"Mail","args":[{"b":1,"a":2.0}]}`, `{"class":"Mail","args":[ 1.0 ]}`,
+			`{"class":"Mail","args":[{"a":2,"b":3}]}`},
+	}...)
+
+	q := queue.New(rds.Pool())
+
+	n, err := q.Dequeue(context.Background(), "mail", "Mail", map[string]int{"a": 2, "b": 1})
+	assert.Eq(t, nil, err)
+	assert.Eq(t, 1, n)
+
+	n, err = q.Dequeue(context.Background(), "mail", "Mail", 1)
+	assert.Eq(t, nil, err)
+	assert.Eq(t, 1, n)
+
+	assert.Eq(t, `{"class":"Mail","args":[{"a":2,"b":3}]}`, strings.Join(rds.List("resque:queue:mail"), ","))
+}
+
+type dequeuePlugin struct {
+	veto   error
+	events []string
+}
+
+func (p *dequeuePlugin) BeforeEnqueue(_ context.Context, _, _ string, _ []interface{}) error {
+	return nil
+}
+
+func (p *dequeuePlugin) AfterEnqueue(_ context.Context, _, _ string, _ []interface{}) error {
+	return nil
+}
+
+func (p *dequeuePlugin) BeforeDequeue(_ context.Context, queue, class string, args []interface{}) error {
+	p.events = append(p.events, fmt.Sprintf("before %s %s %v", queue, class, args))
+	return p.veto
+}
+
+func (p *dequeuePlugin) AfterDequeue(_ context.Context, queue, class string, args []interface{}) error {
+	p.events = append(p.events, fmt.Sprintf("after %s %s %v", queue, class, args))
+	return nil
+}
+
+func TestQueue_DequeuePlugins(t *testing.T) {
+	errLocked := errors.New("locked")
+
+	tests := []struct {
+		name       string
+		veto       error
+		wantErr    error
+		wantCount  int
+		wantEvents string
+		wantLeft   int
+	}{
+		{
+			name:       "plugins run around the removal",
+			wantCount:  3,
+			wantEvents: "before mail Mail [],after mail Mail []",
+			wantLeft:   1,
+		},
+		{
+			name:       "plugin vetoes the removal",
+			veto:       errLocked,
+			wantErr:    errLocked,
+			wantEvents: "before mail Mail []",
+			wantLeft:   4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rds := seedQueues(t)
+			plugin := &dequeuePlugin{veto: tt.veto}
+
+			q := queue.New(rds.Pool())
+			q.RegisterPlugins(plugin)
+
+			n, err := q.Dequeue(context.Background(), "mail", "Mail")
+			assert.Eq(t, true, errors.Is(err, tt.wantErr))
+			assert.Eq(t, tt.wantCount, n)
+			assert.Eq(t, tt.wantEvents, strings.Join(plugin.events, ","))
+			assert.Eq(t, tt.wantLeft, len(rds.List("resque:queue:mail")))
+		})
+	}
+}
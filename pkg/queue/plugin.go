@@ -10,3 +10,27 @@ type Plugin interface {
 	// AfterEnqueue is a function to run after handling a job
 	AfterEnqueue(ctx context.Context, queue, class string, args []interface{}) error
 }
+
+// JobPlugin is implemented by the plugins which rewrite the jobs before they are enqueued, e.g.
+// to add a tenant id to the metadata or to route the job to a shard queue.
+//
+// The enqueue plugins run in the order of their registration: first PrepareEnqueue of every
+// JobPlugin, each one seeing the changes of the previous ones, then BeforeEnqueue of every
+// plugin with the final job and, once the job is enqueued, AfterEnqueue of every plugin with
+// the final job and a context carrying its final metadata.
+type JobPlugin interface {
+	// PrepareEnqueue may change the queue, the class, the arguments and the metadata of the job.
+	// An error cancels the enqueue.
+	PrepareEnqueue(ctx context.Context, jb *Job) error
+}
+
+// DequeuePlugin is implemented by the plugins which run around the removal of jobs with
+// Dequeue, like the Resque before_dequeue and after_dequeue hooks.
+type DequeuePlugin interface {
+	// BeforeDequeue is a function to run before the jobs are removed. An error vetoes the
+	// removal.
+	BeforeDequeue(ctx context.Context, queue, class string, args []interface{}) error
+
+	// AfterDequeue is a function to run after the jobs have been removed.
+	AfterDequeue(ctx context.Context, queue, class string, args []interface{}) error
+}
@@ -3,9 +3,17 @@ package queue
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
 
 	"github.com/snobb/goresq/pkg/db"
+	"github.com/snobb/goresq/pkg/job"
+	"github.com/snobb/goresq/pkg/logger"
+	"github.com/snobb/goresq/pkg/metrics"
+	"github.com/snobb/goresq/pkg/trace"
 )
 
 // Queue is the job enqueuer.
@@ -13,14 +21,88 @@ type Queue struct {
 	Namespace string
 	pool      db.Pooler
 	plugins   []Plugin
+	handlers  map[string]job.Handler
+	recorder  metrics.Recorder
+	tracer    trace.Tracer
+	logger    logger.Logger
+	now       func() time.Time
+	newID     func() string
+}
+
+// Option configures a Queue.
+type Option func(*Queue)
+
+// Inline makes the queue perform enqueued jobs immediately in-process with the given handlers
+// instead of pushing them to redis. The pool is not used in this mode and may be nil. A job
+// aborted with job.ErrSkip or job.ErrDiscard is not an error. There is no queue to push a job
+// aborted with job.ErrRequeue back to, the error is returned to the caller to enqueue it again.
+func Inline(handlers map[string]job.Handler) Option {
+	return func(q *Queue) {
+		q.handlers = handlers
+	}
+}
+
+// WithRecorder sets the recorder receiving the enqueue metrics.
+func WithRecorder(recorder metrics.Recorder) Option {
+	return func(q *Queue) {
+		q.recorder = recorder
+	}
+}
+
+// WithTracer sets the tracer used to trace the enqueued jobs. The trace context is injected
+// into the job payload metadata so that the workers can continue the trace.
+func WithTracer(tracer trace.Tracer) Option {
+	return func(q *Queue) {
+		q.tracer = tracer
+	}
+}
+
+// WithLogger sets the logger receiving the enqueue events.
+func WithLogger(log logger.Logger) Option {
+	return func(q *Queue) {
+		q.logger = log
+	}
+}
+
+type metadataKey struct{}
+
+// WithMetadata returns a copy of the context carrying the headers to set in the payload
+// metadata of the jobs enqueued with it. The headers are added to the ones already carried by
+// the context and are available to the handlers with job.Metadata.
+func WithMetadata(ctx context.Context, headers map[string]string) context.Context {
+	metadata := map[string]string{}
+	for key, value := range metadataFromContext(ctx) {
+		metadata[key] = value
+	}
+
+	for key, value := range headers {
+		metadata[key] = value
+	}
+
+	return context.WithValue(ctx, metadataKey{}, metadata)
+}
+
+func metadataFromContext(ctx context.Context) map[string]string {
+	metadata, _ := ctx.Value(metadataKey{}).(map[string]string)
+	return metadata
 }
 
 // New creates a new instance of Queue
-func New(pool db.Pooler) *Queue {
-	return &Queue{
+func New(pool db.Pooler, opts ...Option) *Queue {
+	q := &Queue{
 		Namespace: "resque",
 		pool:      pool,
+		recorder:  metrics.Nop{},
+		logger:    logger.Nop{},
+		now:       time.Now,
+		newID:     job.NewID,
 	}
+
+	for _, opt := range opts {
+		opt(q)
+	}
+
+	return q
 }
 
 // RegisterPlugins adds a plugin to the queue instance.
@@ -28,43 +110,198 @@ func (q *Queue) RegisterPlugins(plugin ...Plugin) {
 	q.plugins = append(q.plugins, plugin...)
 }
 
-// Enqueue enqueues a job into the queue.
-func (q *Queue) Enqueue(ctx context.Context, queue, class string, data []interface{}) error {
+// EnqueueResult describes an enqueued job.
+type EnqueueResult struct {
+	// ID is the unique id of the job set in the payload.
+	ID string
+
+	// Queue is the queue the job has been pushed to.
+	Queue string
+
+	// Length is the length of the queue right after the job has been pushed. It is zero for
+	// the jobs performed inline.
+	Length int
+}
+
+// Enqueue enqueues a job into the queue. The result is returned once redis has acknowledged
+// the write and the AfterEnqueue plugins are run only after that.
+func (q *Queue) Enqueue(ctx context.Context, queue, class string, data []interface{}) (res EnqueueResult, err error) {
+	if q.tracer != nil {
+		var span trace.Span
+		ctx, span = q.tracer.Start(ctx, trace.SpanEnqueue, trace.JobAttributes(queue, class)...)
+		defer func() { span.End(err) }()
+	}
+
+	res = EnqueueResult{ID: q.newID(), Queue: queue}
+
+	jb := Job{Queue: queue, Class: class, Args: data}
+
+	if q.handlers != nil {
+		err = q.perform(ctx, res.ID, &jb)
+		res.Queue = jb.Queue
+
+		return res, err
+	}
+
 	conn, err := q.pool.Conn()
 	if err != nil {
-		return err
+		return res, err
 	}
 	defer conn.Close()
 
+	ctx, err = q.prepare(ctx, &jb)
+	if err != nil {
+		return res, err
+	}
+
+	res.Queue = jb.Queue
+
+	buf, err := q.encode(ctx, res.ID, jb.Class, jb.Args)
+	if err != nil {
+		return res, err
+	}
+
+	if err = conn.Send("RPUSH", q.key(jb.Queue), buf); err != nil {
+		return res, err
+	}
+
+	if err = conn.Send("SADD", fmt.Sprintf("%s:queues", q.Namespace), jb.Queue); err != nil {
+		return res, err
+	}
+
+	if err = conn.Flush(); err != nil {
+		return res, err
+	}
+
+	res.Length, err = redis.Int(conn.Receive())
+
+	// the SADD reply is read even if RPUSH has failed so that the connection can be reused.
+	if _, serr := conn.Receive(); err == nil {
+		err = serr
+	}
+
+	if err != nil {
+		return res, err
+	}
+
+	q.recorder.JobEnqueued(jb.Queue, jb.Class)
+	q.logger.Debug("job enqueued", logger.F(logger.KeyQueue, jb.Queue), logger.F(logger.KeyClass, jb.Class),
+		logger.F(logger.KeyJobID, res.ID))
+
+	return res, q.afterEnqueue(ctx, jb)
+}
+
+// prepare runs the PrepareEnqueue and the BeforeEnqueue plugins on the job, see JobPlugin. The
+// returned context carries the final metadata of the job.
+func (q *Queue) prepare(ctx context.Context, jb *Job) (context.Context, error) {
+	metadata := map[string]string{}
+	for key, value := range metadataFromContext(ctx) {
+		metadata[key] = value
+	}
+
+	for key, value := range jb.Metadata {
+		metadata[key] = value
+	}
+
+	jb.Metadata = metadata
+
+	for _, plugin := range q.plugins {
+		if p, ok := plugin.(JobPlugin); ok {
+			if err := p.PrepareEnqueue(ctx, jb); err != nil {
+				return ctx, err
+			}
+		}
+	}
+
+	for _, plugin := range q.plugins {
+		if err := plugin.BeforeEnqueue(ctx, jb.Queue, jb.Class, jb.Args); err != nil {
+			return ctx, err
+		}
+	}
+
+	return context.WithValue(ctx, metadataKey{}, jb.Metadata), nil
+}
+
+// afterEnqueue runs the AfterEnqueue plugins with the final job.
+func (q *Queue) afterEnqueue(ctx context.Context, jb Job) error {
 	for _, plugin := range q.plugins {
-		if err := plugin.BeforeEnqueue(ctx, queue, class, data); err != nil {
+		if err := plugin.AfterEnqueue(ctx, jb.Queue, jb.Class, jb.Args); err != nil {
 			return err
 		}
 	}
 
-	payload := struct {
-		Class string        `json:"class"`
-		Args  []interface{} `json:"args"`
-	}{class, data}
+	return nil
+}
 
-	buf, err := json.Marshal(payload)
+// perform runs the job in-process the same way a worker would after fetching it from redis.
+// The job error is returned after the AfterEnqueue plugins have been run.
+func (q *Queue) perform(ctx context.Context, id string, jb *Job) error {
+	ctx, err := q.prepare(ctx, jb)
 	if err != nil {
 		return err
 	}
 
-	if err = conn.Send("RPUSH", fmt.Sprintf("%s:queue:%s", q.Namespace, queue), buf); err != nil {
+	buf, err := q.encode(ctx, id, jb.Class, jb.Args)
+	if err != nil {
 		return err
 	}
 
-	if err = conn.Send("SADD", fmt.Sprintf("%s:queues", q.Namespace), queue); err != nil {
+	inline := &job.Job{Queue: jb.Queue}
+	if err := json.Unmarshal(buf, &inline.Payload); err != nil {
 		return err
 	}
 
-	for _, plugin := range q.plugins {
-		if err := plugin.AfterEnqueue(ctx, queue, class, data); err != nil {
-			return err
-		}
+	var jobErr error
+	if q.tracer != nil {
+		_, jobErr = trace.Run(ctx, q.tracer, q.handlers, inline)
+	} else {
+		_, jobErr = job.Run(ctx, q.handlers, inline)
 	}
 
-	return nil
+	fields := []logger.Field{
+		logger.F(logger.KeyQueue, jb.Queue), logger.F(logger.KeyClass, jb.Class), logger.F(logger.KeyJobID, id),
+	}
+
+	switch {
+	case jobErr == nil:
+		q.logger.Debug("inline job performed", fields...)
+
+	case errors.Is(jobErr, job.ErrRequeue):
+		q.logger.Info("inline job requeued", append(fields, logger.F(logger.KeyError, jobErr))...)
+
+	case job.Aborted(jobErr):
+		q.logger.Info("inline job aborted", append(fields, logger.F(logger.KeyError, jobErr))...)
+		jobErr = nil
+
+	default:
+		q.logger.Error("inline job failed", append(fields, logger.F(logger.KeyError, jobErr))...)
+	}
+
+	if err := q.afterEnqueue(ctx, *jb); err != nil {
+		return err
+	}
+
+	return jobErr
+}
+
+func (q *Queue) encode(ctx context.Context, id, class string, data []interface{}) ([]byte, error) {
+	metadata := map[string]string{}
+	for key, value := range metadataFromContext(ctx) {
+		metadata[key] = value
+	}
+
+	if q.tracer != nil {
+		q.tracer.Inject(ctx, metadata)
+	}
+
+	payload := struct {
+		Class      string            `json:"class"`
+		Args       []interface{}     `json:"args"`
+		ID         string            `json:"id"`
+		EnqueuedAt float64           `json:"enqueued_at"`
+		Attempt    int               `json:"attempt"`
+		Metadata   map[string]string `json:"metadata,omitempty"`
+	}{class, data, id, job.Timestamp(q.now()), 1, metadata}
+
+	return json.Marshal(payload)
 }
@@ -2,13 +2,22 @@ package queue_test
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
 
 	"github.com/snobb/goresq/pkg/db"
 	"github.com/snobb/goresq/pkg/db/mock"
+	"github.com/snobb/goresq/pkg/job"
 	"github.com/snobb/goresq/pkg/queue"
+	"github.com/snobb/goresq/pkg/trace"
 	"github.com/snobb/goresq/test/assert"
+	"github.com/snobb/goresq/test/fakeredis"
 )
 
 type plugin struct {
@@ -29,6 +38,10 @@ func (p *plugin) AfterEnqueue(ctx context.Context, queue string, class string, a
 	return p.afterFunc(ctx, queue, class, args)
 }
 
+func nopPluginFunc(_ context.Context, _, _ string, _ []interface{}) error {
+	return nil
+}
+
 func TestQueue_Enqueue(t *testing.T) {
 	class := "foobar"
 	queueName := "queue1"
@@ -42,18 +55,38 @@ func TestQueue_Enqueue(t *testing.T) {
 		wantBeforeCalls int
 		wantDbErr       bool
 		wantSendErr     int
+		wantReplyErr    int
 		wantErr         bool
 	}{
 		{
 			name: "should enqueue a job successfully (no plugins)",
 			data: []interface{}{"taskdata"},
 			wantRedisCmds: []string{
-				fmt.Sprintf(`RPUSH resque:queue:queue1 {"class":"%s","args":["taskdata"]}`, class),
+				fmt.Sprintf(`RPUSH resque:queue:queue1 {"class":"%s","args":["taskdata"],"id":"job-1","enqueued_at":1700000000,"attempt":1}`, class),
 				"SADD resque:queues queue1",
+				"Conn::Flush",
 			},
 			wantAfterCalls:  1,
 			wantBeforeCalls: 1,
 		},
+		{
+			name:            "should not run the after plugins if redis rejects the job",
+			data:            []interface{}{"taskdata"},
+			plugins:         []*plugin{{beforeFunc: nopPluginFunc, afterFunc: nopPluginFunc}},
+			wantReplyErr:    1,
+			wantAfterCalls:  0,
+			wantBeforeCalls: 1,
+			wantErr:         true,
+		},
+		{
+			name:            "should fail if redis fails to register the queue",
+			data:            []interface{}{"taskdata"},
+			plugins:         []*plugin{{beforeFunc: nopPluginFunc, afterFunc: nopPluginFunc}},
+			wantReplyErr:    2,
+			wantAfterCalls:  0,
+			wantBeforeCalls: 1,
+			wantErr:         true,
+		},
 		{
 			name: "should enqueue a job successfully and run plugins",
 			data: []interface{}{"taskdata"},
@@ -74,7 +107,7 @@ func TestQueue_Enqueue(t *testing.T) {
 				},
 			},
 			wantRedisCmds: []string{
-				fmt.Sprintf(`RPUSH resque:queue:queue1 {"class":"%s","args":["taskdata"]}`, class),
+				fmt.Sprintf(`RPUSH resque:queue:queue1 {"class":"%s","args":["taskdata"],"id":"job-1","enqueued_at":1700000000,"attempt":1}`, class),
 				"SADD resque:queues queue1",
 			},
 			wantAfterCalls:  1,
@@ -204,6 +237,7 @@ func TestQueue_Enqueue(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			var redisCmds []string
 
+			received := 0
 			mockedConn := &mock.ConnMock{
 				CloseFunc: func() error {
 					redisCmds = append(redisCmds, "Conn::Close")
@@ -216,10 +250,16 @@ func TestQueue_Enqueue(t *testing.T) {
 					panic("mock out the Err method")
 				},
 				FlushFunc: func() error {
-					panic("mock out the Flush method")
+					redisCmds = append(redisCmds, "Conn::Flush")
+					return nil
 				},
 				ReceiveFunc: func() (interface{}, error) {
-					panic("mock out the Receive method")
+					received++
+					if received == tt.wantReplyErr {
+						return nil, redis.Error("ERR spanner")
+					}
+
+					return int64(3), nil
 				},
 				SendFunc: func(commandName string, args ...interface{}) error {
 					if tt.wantSendErr == 1 {
@@ -241,6 +281,8 @@ func TestQueue_Enqueue(t *testing.T) {
 			}
 
 			q := queue.New(mockedPool)
+			queue.SetNow(q, func() time.Time { return time.Unix(1700000000, 0) })
+			queue.SetNewID(q, func() string { return "job-1" })
 			var plugins []queue.Plugin
 			for _, p := range tt.plugins {
 				plugins = append(plugins, p)
@@ -249,10 +291,15 @@ func TestQueue_Enqueue(t *testing.T) {
 			q.RegisterPlugins(plugins...)
 
 			ctx := context.Background()
-			if err := q.Enqueue(ctx, queueName, class, tt.data); (err != nil) != tt.wantErr {
+			res, err := q.Enqueue(ctx, queueName, class, tt.data)
+			if (err != nil) != tt.wantErr {
 				t.Errorf("Queue.Enqueue() error = %v", err)
 			}
 
+			if !tt.wantErr {
+				assert.Eq(t, queue.EnqueueResult{ID: "job-1", Queue: queueName, Length: 3}, res)
+			}
+
 			for _, p := range tt.plugins {
 				assert.Eq(t, tt.wantBeforeCalls, p.beforeCount)
 				assert.Eq(t, tt.wantAfterCalls, p.afterCount)
@@ -264,3 +311,328 @@ func TestQueue_Enqueue(t *testing.T) {
 		})
 	}
 }
+
+type jobPlugin struct {
+	calls []string
+}
+
+// BeforePerform is a function to run before handling a job.
+func (p *jobPlugin) BeforePerform(_ context.Context, _, _ string, _ []json.RawMessage) error {
+	p.calls = append(p.calls, "BeforePerform")
+	return nil
+}
+
+// AfterPerform is a function to run after handling a job
+func (p *jobPlugin) AfterPerform(_ context.Context, _, _ string, _ []json.RawMessage, _ job.Result, err error) error {
+	p.calls = append(p.calls, "AfterPerform")
+	return err
+}
+
+type inlineHandler struct {
+	plugin  *jobPlugin
+	perform job.PerformFunc
+}
+
+func (h *inlineHandler) Plugins() []job.Plugin {
+	return []job.Plugin{h.plugin}
+}
+
+func (h *inlineHandler) Perform(ctx context.Context, queue, class string, args []json.RawMessage) (job.Result, error) {
+	h.plugin.calls = append(h.plugin.calls, "Perform")
+	return h.perform(ctx, queue, class, args)
+}
+
+func TestQueue_EnqueueInline(t *testing.T) {
+	queueName := "queue1"
+
+	tests := []struct {
+		name            string
+		class           string
+		perform         job.PerformFunc
+		beforeErr       error
+		wantJobCalls    []string
+		wantBeforeCalls int
+		wantAfterCalls  int
+		wantErrIs       error
+		wantErr         bool
+	}{
+		{
+			name:  "should perform the job in-process",
+			class: "foobar",
+			perform: func(_ context.Context, q, c string, args []json.RawMessage) (job.Result, error) {
+				assert.Eq(t, queueName, q)
+				assert.Eq(t, "foobar", c)
+				assert.Eq(t, `{"foo":"bar"}`, string(args[0]))
+				return "ok", nil
+			},
+			wantJobCalls:    []string{"BeforePerform", "Perform", "AfterPerform"},
+			wantBeforeCalls: 1,
+			wantAfterCalls:  1,
+		},
+		{
+			name:  "should return the job error after running the enqueue plugins",
+			class: "foobar",
+			perform: func(_ context.Context, _, _ string, _ []json.RawMessage) (job.Result, error) {
+				return nil, fmt.Errorf("spanner")
+			},
+			wantJobCalls:    []string{"BeforePerform", "Perform", "AfterPerform"},
+			wantBeforeCalls: 1,
+			wantAfterCalls:  1,
+			wantErr:         true,
+		},
+		{
+			name:  "should not perform the job if the before plugin fails",
+			class: "foobar",
+			perform: func(_ context.Context, _, _ string, _ []json.RawMessage) (job.Result, error) {
+				t.Errorf("must not happen")
+				return nil, nil
+			},
+			beforeErr:       fmt.Errorf("spanner"),
+			wantBeforeCalls: 1,
+			wantErr:         true,
+		},
+		{
+			name:  "should not fail if the job is skipped",
+			class: "foobar",
+			perform: func(_ context.Context, _, _ string, _ []json.RawMessage) (job.Result, error) {
+				return nil, job.ErrSkip
+			},
+			wantJobCalls:    []string{"BeforePerform", "Perform"},
+			wantBeforeCalls: 1,
+			wantAfterCalls:  1,
+		},
+		{
+			name:  "should not fail if the job is discarded",
+			class: "foobar",
+			perform: func(_ context.Context, _, _ string, _ []json.RawMessage) (job.Result, error) {
+				return nil, job.ErrDiscard
+			},
+			wantJobCalls:    []string{"BeforePerform", "Perform"},
+			wantBeforeCalls: 1,
+			wantAfterCalls:  1,
+		},
+		{
+			name:  "should return the requeue to the caller",
+			class: "foobar",
+			perform: func(_ context.Context, _, _ string, _ []json.RawMessage) (job.Result, error) {
+				return nil, job.ErrRequeue
+			},
+			wantJobCalls:    []string{"BeforePerform", "Perform"},
+			wantBeforeCalls: 1,
+			wantAfterCalls:  1,
+			wantErrIs:       job.ErrRequeue,
+			wantErr:         true,
+		},
+		{
+			name:            "should fail if there is no handler for the class",
+			class:           "unknown",
+			wantBeforeCalls: 1,
+			wantAfterCalls:  1,
+			wantErrIs:       job.ErrNoHandler,
+			wantErr:         true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jp := &jobPlugin{}
+			handlers := map[string]job.Handler{
+				"foobar": &inlineHandler{plugin: jp, perform: tt.perform},
+			}
+
+			p := &plugin{
+				beforeFunc: func(_ context.Context, _, _ string, _ []interface{}) error {
+					return tt.beforeErr
+				},
+				afterFunc: func(_ context.Context, _, _ string, _ []interface{}) error {
+					return nil
+				},
+			}
+
+			q := queue.New(nil, queue.Inline(handlers))
+			q.RegisterPlugins(p)
+
+			data := []interface{}{map[string]string{"foo": "bar"}}
+			_, err := q.Enqueue(context.Background(), queueName, tt.class, data)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Queue.Enqueue() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErrIs != nil {
+				assert.Eq(t, true, errors.Is(err, tt.wantErrIs))
+			}
+
+			assert.Eq(t, tt.wantBeforeCalls, p.beforeCount)
+			assert.Eq(t, tt.wantAfterCalls, p.afterCount)
+			assert.Eq(t, len(tt.wantJobCalls), len(jp.calls))
+
+			for i, call := range tt.wantJobCalls {
+				assert.Eq(t, call, jp.calls[i])
+			}
+		})
+	}
+}
+
+func TestQueue_EnqueueTraced(t *testing.T) {
+	tracer := trace.W3C{}
+	ctx, _ := tracer.Start(context.Background(), "request")
+	producer, _ := trace.SpanContextFromContext(ctx)
+
+	var consumer trace.SpanContext
+	handlers := map[string]job.Handler{
+		"foobar": job.PerformFunc(func(ctx context.Context, _, _ string, _ []json.RawMessage) (job.Result, error) {
+			consumer, _ = trace.SpanContextFromContext(ctx)
+			return nil, nil
+		}),
+	}
+
+	q := queue.New(nil, queue.Inline(handlers), queue.WithTracer(tracer))
+	if _, err := q.Enqueue(ctx, "queue1", "foobar", []interface{}{"taskdata"}); err != nil {
+		t.Fatalf("Queue.Enqueue() error = %v", err)
+	}
+
+	assert.Eq(t, producer.TraceID, consumer.TraceID)
+	assert.Eq(t, true, producer.SpanID != consumer.SpanID)
+}
+
+func TestQueue_EnqueueMetadata(t *testing.T) {
+	var (
+		id         string
+		attempt    int
+		enqueuedAt time.Time
+		metadata   map[string]string
+		execution  *job.Execution
+	)
+
+	handlers := map[string]job.Handler{
+		"foobar": job.PerformFunc(func(ctx context.Context, _, _ string, _ []json.RawMessage) (job.Result, error) {
+			id, attempt, enqueuedAt, metadata = job.ID(ctx), job.Attempt(ctx), job.EnqueuedAt(ctx), job.Metadata(ctx)
+			execution, _ = job.FromContext(ctx)
+			return nil, nil
+		}),
+	}
+
+	q := queue.New(nil, queue.Inline(handlers))
+	queue.SetNow(q, func() time.Time { return time.Unix(1700000000, 0) })
+	queue.SetNewID(q, func() string { return "job-1" })
+
+	ctx := queue.WithMetadata(context.Background(), map[string]string{"tenant": "acme", "request_id": "r1"})
+	ctx = queue.WithMetadata(ctx, map[string]string{"request_id": "r2"})
+
+	res, err := q.Enqueue(ctx, "queue1", "foobar", nil)
+	assert.Eq(t, nil, err)
+	assert.Eq(t, "job-1", res.ID)
+
+	assert.Eq(t, "job-1", id)
+	assert.Eq(t, 1, attempt)
+	assert.Eq(t, int64(1700000000), enqueuedAt.Unix())
+	assert.Eq(t, 2, len(metadata))
+	assert.Eq(t, "acme", metadata["tenant"])
+	assert.Eq(t, "r2", metadata["request_id"])
+
+	assert.Eq(t, "", execution.Worker)
+	assert.Eq(t, "queue1", execution.Queue)
+	assert.Eq(t, "foobar", execution.Payload.Class)
+	assert.Eq(t, false, execution.StartedAt.IsZero())
+
+	_, ok := job.FromContext(context.Background())
+	assert.Eq(t, false, ok)
+
+	// the accessors are safe to use outside of a job.
+	assert.Eq(t, "", job.ID(context.Background()))
+	assert.Eq(t, 1, job.Attempt(context.Background()))
+	assert.Eq(t, true, job.EnqueuedAt(context.Background()).IsZero())
+}
+
+type routePlugin struct {
+	name   string
+	events *[]string
+	route  func(jb *queue.Job)
+}
+
+func (p *routePlugin) PrepareEnqueue(_ context.Context, jb *queue.Job) error {
+	*p.events = append(*p.events, fmt.Sprintf("%s prepare %s %s %v", p.name, jb.Queue, jb.Class, jb.Args))
+	p.route(jb)
+
+	return nil
+}
+
+func (p *routePlugin) BeforeEnqueue(_ context.Context, queue, class string, args []interface{}) error {
+	*p.events = append(*p.events, fmt.Sprintf("%s before %s %s %v", p.name, queue, class, args))
+	return nil
+}
+
+func (p *routePlugin) AfterEnqueue(_ context.Context, queue, class string, args []interface{}) error {
+	*p.events = append(*p.events, fmt.Sprintf("%s after %s %s %v", p.name, queue, class, args))
+	return nil
+}
+
+func TestQueue_EnqueueJobPlugins(t *testing.T) {
+	wantEvents := strings.Join([]string{
+		"tenant prepare mail Mail [1]",
+		"shard prepare mail Mail [1 acme]",
+		"tenant before mail_acme Mail [1 acme]",
+		"shard before mail_acme Mail [1 acme]",
+		"tenant after mail_acme Mail [1 acme]",
+		"shard after mail_acme Mail [1 acme]",
+	}, "\n")
+
+	tests := []struct {
+		name    string
+		enqueue func(q *queue.Queue) (queue.EnqueueResult, error)
+	}{
+		{
+			name: "enqueue",
+			enqueue: func(q *queue.Queue) (queue.EnqueueResult, error) {
+				return q.Enqueue(queue.WithMetadata(context.Background(), map[string]string{"source": "api"}),
+					"mail", "Mail", []interface{}{1})
+			},
+		},
+		{
+			name: "batch",
+			enqueue: func(q *queue.Queue) (queue.EnqueueResult, error) {
+				res, err := q.EnqueueBatch(context.Background(), []queue.Job{
+					{Queue: "mail", Class: "Mail", Args: []interface{}{1}, Metadata: map[string]string{"source": "api"}},
+				})
+				if err != nil {
+					return queue.EnqueueResult{}, err
+				}
+
+				return res[0], nil
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rds := fakeredis.New()
+
+			var events []string
+
+			q := queue.New(rds.Pool())
+			queue.SetNow(q, func() time.Time { return time.Unix(1700000000, 0) })
+			queue.SetNewID(q, func() string { return "job-1" })
+			q.RegisterPlugins(
+				&routePlugin{name: "tenant", events: &events, route: func(jb *queue.Job) {
+					jb.Args = append(jb.Args, "acme")
+					jb.Metadata["tenant"] = "acme"
+				}},
+				&routePlugin{name: "shard", events: &events, route: func(jb *queue.Job) {
+					jb.Queue = jb.Queue + "_" + jb.Metadata["tenant"]
+					delete(jb.Metadata, "source")
+				}},
+			)
+
+			res, err := tt.enqueue(q)
+			assert.Eq(t, nil, err)
+			assert.Eq(t, "mail_acme", res.Queue)
+			assert.Eq(t, 1, res.Length)
+			assert.Eq(t, wantEvents, strings.Join(events, "\n"))
+
+			assert.Eq(t, 0, len(rds.List("resque:queue:mail")))
+			assert.Eq(t, `{"class":"Mail","args":[1,"acme"],"id":"job-1","enqueued_at":1700000000,"attempt":1,`+
+				`"metadata":{"tenant":"acme"}}`, strings.Join(rds.List("resque:queue:mail_acme"), ","))
+			assert.Eq(t, "mail_acme", strings.Join(rds.Members("resque:queues"), ","))
+		})
+	}
+}
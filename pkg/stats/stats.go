@@ -0,0 +1,185 @@
+package stats
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gomodule/redigo/redis"
+
+	"github.com/snobb/goresq/pkg/db"
+)
+
+// The names of the counters.
+const (
+	Processed = "processed"
+	Failed    = "failed"
+	Skipped   = "skipped"
+	Requeued  = "requeued"
+	Discarded = "discarded"
+)
+
+// Names returns the names of all the counters.
+func Names() []string {
+	return []string{Processed, Failed, Skipped, Requeued, Discarded}
+}
+
+// TotalKey returns the key of the global counter as used by Resque.
+func TotalKey(namespace, name string) string {
+	return fmt.Sprintf("%s:stat:%s", namespace, name)
+}
+
+// WorkerKey returns the key of the worker counter as used by Resque.
+func WorkerKey(namespace, worker, name string) string {
+	return fmt.Sprintf("%s:stat:%s:%s", namespace, name, worker)
+}
+
+// QueueKey returns the key of the queue counter.
+func QueueKey(namespace, queue, name string) string {
+	return fmt.Sprintf("%s:stat:queue:%s:%s", namespace, queue, name)
+}
+
+// Counts represents the job counters. The skipped, requeued and discarded jobs are the jobs
+// aborted by their plugins, see job.ErrSkip, job.ErrRequeue and job.ErrDiscard.
+type Counts struct {
+	Processed int `json:"processed"`
+	Failed    int `json:"failed"`
+	Skipped   int `json:"skipped,omitempty"`
+	Requeued  int `json:"requeued,omitempty"`
+	Discarded int `json:"discarded,omitempty"`
+}
+
+// Stats reads and resets the job counters recorded by the workers.
+type Stats struct {
+	Namespace string
+	pool      db.Pooler
+}
+
+// New creates a new Stats.
+func New(pool db.Pooler) *Stats {
+	return &Stats{
+		Namespace: "resque",
+		pool:      pool,
+	}
+}
+
+// Total returns the global counters.
+func (s *Stats) Total() (Counts, error) {
+	return s.counts(func(name string) string {
+		return TotalKey(s.Namespace, name)
+	})
+}
+
+// Worker returns the counters of the worker.
+func (s *Stats) Worker(worker string) (Counts, error) {
+	return s.counts(func(name string) string {
+		return WorkerKey(s.Namespace, worker, name)
+	})
+}
+
+// Queue returns the counters of the queue.
+func (s *Stats) Queue(queue string) (Counts, error) {
+	return s.counts(func(name string) string {
+		return QueueKey(s.Namespace, queue, name)
+	})
+}
+
+// Workers returns the counters of the registered workers by worker id.
+func (s *Stats) Workers() (map[string]Counts, error) {
+	return s.each(fmt.Sprintf("%s:workers", s.Namespace), s.Worker)
+}
+
+// Queues returns the counters of the registered queues by queue name.
+func (s *Stats) Queues() (map[string]Counts, error) {
+	return s.each(fmt.Sprintf("%s:queues", s.Namespace), s.Queue)
+}
+
+// Reset sets the global, the registered workers and the registered queues counters to zero.
+func (s *Stats) Reset() error {
+	conn, err := s.pool.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	workers, err := redis.Strings(conn.Do("SMEMBERS", fmt.Sprintf("%s:workers", s.Namespace)))
+	if err != nil {
+		return err
+	}
+
+	queues, err := redis.Strings(conn.Do("SMEMBERS", fmt.Sprintf("%s:queues", s.Namespace)))
+	if err != nil {
+		return err
+	}
+
+	keys := []interface{}{}
+
+	for _, name := range Names() {
+		keys = append(keys, TotalKey(s.Namespace, name))
+
+		for _, worker := range workers {
+			keys = append(keys, WorkerKey(s.Namespace, worker, name))
+		}
+
+		for _, queue := range queues {
+			keys = append(keys, QueueKey(s.Namespace, queue, name))
+		}
+	}
+
+	_, err = conn.Do("DEL", keys...)
+
+	return err
+}
+
+func (s *Stats) counts(key func(name string) string) (Counts, error) {
+	conn, err := s.pool.Conn()
+	if err != nil {
+		return Counts{}, err
+	}
+	defer conn.Close()
+
+	var counts Counts
+
+	for name, dst := range map[string]*int{
+		Processed: &counts.Processed,
+		Failed:    &counts.Failed,
+		Skipped:   &counts.Skipped,
+		Requeued:  &counts.Requeued,
+		Discarded: &counts.Discarded,
+	} {
+		n, err := redis.Int(conn.Do("GET", key(name)))
+		if err != nil && !errors.Is(err, redis.ErrNil) {
+			return Counts{}, err
+		}
+
+		*dst = n
+	}
+
+	return counts, nil
+}
+
+func (s *Stats) each(set string, get func(string) (Counts, error)) (map[string]Counts, error) {
+	conn, err := s.pool.Conn()
+	if err != nil {
+		return nil, err
+	}
+
+	members, err := redis.Strings(conn.Do("SMEMBERS", set))
+	conn.Close()
+
+	if err != nil {
+		return nil, err
+	}
+
+	res := make(map[string]Counts, len(members))
+
+	for _, member := range members {
+		counts, err := get(member)
+		if err != nil {
+			return nil, err
+		}
+
+		res[member] = counts
+	}
+
+	return res, nil
+}
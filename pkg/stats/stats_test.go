@@ -0,0 +1,69 @@
+package stats_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/snobb/goresq/pkg/stats"
+
+	"github.com/snobb/goresq/test/assert"
+	"github.com/snobb/goresq/test/fakeredis"
+)
+
+const worker = "host:1-worker1:mail"
+
+func seed(t *testing.T) *fakeredis.Redis {
+	t.Helper()
+
+	rds := fakeredis.New()
+
+	rds.Seed(t, [][]interface{}{
+		{"SADD", "resque:workers", worker},
+		{"SADD", "resque:queues", "mail", "sms"},
+		{"SET", "resque:stat:processed", "10"},
+		{"SET", "resque:stat:failed", "2"},
+		{"SET", "resque:stat:processed:" + worker, "7"},
+		{"SET", "resque:stat:failed:" + worker, "1"},
+		{"SET", "resque:stat:queue:mail:processed", "6"},
+		{"SET", "resque:stat:queue:mail:failed", "2"},
+		{"SET", "resque:stat:queue:gone:processed", "4"},
+	}...)
+
+	return rds
+}
+
+func TestStats(t *testing.T) {
+	s := stats.New(seed(t).Pool())
+
+	total, err := s.Total()
+	assert.Eq(t, nil, err)
+	assert.Eq(t, stats.Counts{Processed: 10, Failed: 2}, total)
+
+	counts, err := s.Worker(worker)
+	assert.Eq(t, nil, err)
+	assert.Eq(t, stats.Counts{Processed: 7, Failed: 1}, counts)
+
+	counts, err = s.Queue("gone")
+	assert.Eq(t, nil, err)
+	assert.Eq(t, stats.Counts{Processed: 4}, counts)
+
+	workers, err := s.Workers()
+	assert.Eq(t, nil, err)
+	assert.Eq(t, 1, len(workers))
+	assert.Eq(t, stats.Counts{Processed: 7, Failed: 1}, workers[worker])
+
+	queues, err := s.Queues()
+	assert.Eq(t, nil, err)
+	assert.Eq(t, 2, len(queues))
+	assert.Eq(t, stats.Counts{Processed: 6, Failed: 2}, queues["mail"])
+	assert.Eq(t, stats.Counts{}, queues["sms"])
+}
+
+func TestStats_Reset(t *testing.T) {
+	rds := seed(t)
+
+	assert.Eq(t, nil, stats.New(rds.Pool()).Reset())
+
+	// the counters of the unregistered queues are left untouched.
+	assert.Eq(t, "resque:stat:queue:gone:processed", strings.Join(rds.Keys("resque:stat:*"), ","))
+}
@@ -0,0 +1,128 @@
+package trace
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/snobb/goresq/pkg/job"
+)
+
+// Span names used for the job execution.
+const (
+	SpanEnqueue       = "goresq.enqueue"
+	SpanEnqueueBatch  = "goresq.enqueue_batch"
+	SpanJob           = "goresq.job"
+	SpanBeforePerform = "goresq.before_perform"
+	SpanPerform       = "goresq.perform"
+	SpanAfterPerform  = "goresq.after_perform"
+	SpanOnFailure     = "goresq.on_failure"
+)
+
+type handler struct {
+	tracer  Tracer
+	handler job.Handler
+}
+
+type plugin struct {
+	tracer Tracer
+	plugin job.Plugin
+}
+
+// failurePlugin is a traced plugin implementing job.FailurePlugin.
+type failurePlugin struct {
+	*plugin
+}
+
+// JobAttributes returns the span attributes describing the job.
+func JobAttributes(queue, class string) []Attribute {
+	return []Attribute{
+		{Key: "goresq.queue", Value: queue},
+		{Key: "goresq.class", Value: class},
+	}
+}
+
+// Run continues the trace found in the job payload metadata and performs the job in a span
+// with Perform and each of the handler plugins traced as its children.
+func Run(ctx context.Context, tracer Tracer, handlers map[string]job.Handler, jb *job.Job) (result job.Result, err error) {
+	ctx = tracer.Extract(ctx, jb.Payload.Metadata)
+
+	ctx, span := tracer.Start(ctx, SpanJob, JobAttributes(jb.Queue, jb.Payload.Class)...)
+	defer func() { span.End(err) }()
+
+	return job.Run(ctx, Handlers(tracer, handlers), jb)
+}
+
+// Handlers wraps the handlers so that Perform and each of the handler plugins run in their own
+// span.
+func Handlers(tracer Tracer, handlers map[string]job.Handler) map[string]job.Handler {
+	traced := make(map[string]job.Handler, len(handlers))
+
+	for class, h := range handlers {
+		traced[class] = &handler{tracer: tracer, handler: h}
+	}
+
+	return traced
+}
+
+// Plugins returns a list of registered plugins with the handler.
+func (h *handler) Plugins() []job.Plugin {
+	plugins := h.handler.Plugins()
+	traced := make([]job.Plugin, len(plugins))
+
+	for i, p := range plugins {
+		tp := &plugin{tracer: h.tracer, plugin: p}
+		traced[i] = tp
+
+		if _, ok := p.(job.FailurePlugin); ok {
+			traced[i] = &failurePlugin{tp}
+		}
+	}
+
+	return traced
+}
+
+// Perform is a function that handles the job
+func (h *handler) Perform(ctx context.Context, queue, class string, args []json.RawMessage) (result job.Result, err error) {
+	ctx, span := h.tracer.Start(ctx, SpanPerform, JobAttributes(queue, class)...)
+	defer func() { span.End(err) }()
+
+	return h.handler.Perform(ctx, queue, class, args)
+}
+
+// BeforePerform is a function to run before handling a job.
+func (p *plugin) BeforePerform(ctx context.Context, queue, class string, args []json.RawMessage) (err error) {
+	ctx, span := p.tracer.Start(ctx, SpanBeforePerform, p.attributes(queue, class)...)
+	defer func() { span.End(err) }()
+
+	return p.plugin.BeforePerform(ctx, queue, class, args)
+}
+
+// AfterPerform is a function to run after handling a job
+func (p *plugin) AfterPerform(ctx context.Context, queue, class string, args []json.RawMessage, result job.Result,
+	jobErr error,
+) (err error) {
+	ctx, span := p.tracer.Start(ctx, SpanAfterPerform, p.attributes(queue, class)...)
+	defer func() { span.End(err) }()
+
+	return p.plugin.AfterPerform(ctx, queue, class, args, result, jobErr)
+}
+
+// OnFailure is a function to run when the job fails.
+func (p *failurePlugin) OnFailure(ctx context.Context, queue, class string, args []json.RawMessage,
+	jobErr error,
+) (err error) {
+	ctx, span := p.tracer.Start(ctx, SpanOnFailure, p.attributes(queue, class)...)
+	defer func() { span.End(err) }()
+
+	return p.plugin.plugin.(job.FailurePlugin).OnFailure(ctx, queue, class, args, jobErr)
+}
+
+// Unwrap returns the traced plugin, so that the plugin errors name it rather than the wrapper.
+func (p *plugin) Unwrap() job.Plugin {
+	return p.plugin
+}
+
+func (p *plugin) attributes(queue, class string) []Attribute {
+	return append(JobAttributes(queue, class), Attribute{Key: "goresq.plugin", Value: fmt.Sprintf("%T", p.plugin)})
+}
@@ -0,0 +1,49 @@
+package trace
+
+import "context"
+
+// Attribute is a key-value pair attached to a span.
+type Attribute struct {
+	Key   string
+	Value string
+}
+
+// Span represents a traced operation.
+type Span interface {
+	// End completes the span recording the error if it is not nil.
+	End(err error)
+}
+
+// Tracer starts spans and propagates their context through the job payloads. It can be
+// implemented on top of OpenTelemetry or any other tracing library.
+type Tracer interface {
+	// Start starts a new span as a child of the span found in the context.
+	Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span)
+
+	// Inject writes the span context found in the context into the carrier.
+	Inject(ctx context.Context, carrier map[string]string)
+
+	// Extract returns a context holding the remote span context found in the carrier.
+	Extract(ctx context.Context, carrier map[string]string) context.Context
+}
+
+// Nop is a tracer that neither records nor propagates the spans.
+type Nop struct{}
+
+type nopSpan struct{}
+
+// End completes the span.
+func (nopSpan) End(_ error) {}
+
+// Start starts a new span.
+func (Nop) Start(ctx context.Context, _ string, _ ...Attribute) (context.Context, Span) {
+	return ctx, nopSpan{}
+}
+
+// Inject writes the span context into the carrier.
+func (Nop) Inject(_ context.Context, _ map[string]string) {}
+
+// Extract returns a context holding the remote span context.
+func (Nop) Extract(ctx context.Context, _ map[string]string) context.Context {
+	return ctx
+}
@@ -0,0 +1,250 @@
+package trace_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/snobb/goresq/pkg/job"
+	"github.com/snobb/goresq/pkg/trace"
+	"github.com/snobb/goresq/test/assert"
+)
+
+func TestParseTraceParent(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		wantErr bool
+	}{
+		{
+			name:  "should parse a valid traceparent",
+			value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		},
+		{
+			name:  "should parse a traceparent of a future version",
+			value: "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-future",
+		},
+		{
+			name:    "should fail on an empty value",
+			value:   "",
+			wantErr: true,
+		},
+		{
+			name:    "should fail on the forbidden version",
+			value:   "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			wantErr: true,
+		},
+		{
+			name:    "should fail on extra fields in version 00",
+			value:   "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+			wantErr: true,
+		},
+		{
+			name:    "should fail on a short trace id",
+			value:   "00-4bf92f3577b34da6a3ce929d0e0e47-00f067aa0ba902b7-01",
+			wantErr: true,
+		},
+		{
+			name:    "should fail on a zero span id",
+			value:   "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+			wantErr: true,
+		},
+		{
+			name:    "should fail on non hex characters",
+			value:   "00-4bf92f3577b34da6a3ce929d0e0e473z-00f067aa0ba902b7-01",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc, err := trace.ParseTraceParent(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseTraceParent() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if err != nil {
+				assert.Eq(t, true, errors.Is(err, trace.ErrInvalidTraceParent))
+				return
+			}
+
+			assert.Eq(t, "4bf92f3577b34da6a3ce929d0e0e4736", fmt.Sprintf("%x", sc.TraceID))
+			assert.Eq(t, "00f067aa0ba902b7", fmt.Sprintf("%x", sc.SpanID))
+		})
+	}
+}
+
+func TestW3C_Propagation(t *testing.T) {
+	tracer := trace.W3C{}
+
+	ctx, _ := tracer.Start(context.Background(), trace.SpanEnqueue)
+	producer, ok := trace.SpanContextFromContext(ctx)
+	assert.Eq(t, true, ok)
+
+	carrier := map[string]string{}
+	tracer.Inject(ctx, carrier)
+	assert.Eq(t, producer.TraceParent(), carrier[trace.TraceParentKey])
+
+	ctx = tracer.Extract(context.Background(), carrier)
+	ctx, _ = tracer.Start(ctx, trace.SpanJob)
+	consumer, ok := trace.SpanContextFromContext(ctx)
+	assert.Eq(t, true, ok)
+
+	assert.Eq(t, producer.TraceID, consumer.TraceID)
+	assert.Eq(t, true, producer.SpanID != consumer.SpanID)
+}
+
+type recorder struct {
+	started []string
+	ended   []string
+}
+
+type span struct {
+	name string
+	rec  *recorder
+}
+
+func (s *span) End(err error) {
+	s.rec.ended = append(s.rec.ended, fmt.Sprintf("%s:%v", s.name, err))
+}
+
+func (r *recorder) Start(ctx context.Context, name string, _ ...trace.Attribute) (context.Context, trace.Span) {
+	r.started = append(r.started, name)
+	return ctx, &span{name: name, rec: r}
+}
+
+func (r *recorder) Inject(_ context.Context, _ map[string]string) {}
+
+func (r *recorder) Extract(ctx context.Context, carrier map[string]string) context.Context {
+	r.started = append(r.started, "extract:"+carrier[trace.TraceParentKey])
+	return ctx
+}
+
+type plugin struct {
+	err error
+}
+
+// BeforePerform is a function to run before handling a job.
+func (p *plugin) BeforePerform(_ context.Context, _, _ string, _ []json.RawMessage) error {
+	return p.err
+}
+
+// AfterPerform is a function to run after handling a job
+func (p *plugin) AfterPerform(_ context.Context, _, _ string, _ []json.RawMessage, _ job.Result, err error) error {
+	return err
+}
+
+// OnFailure is a function to run when the job fails.
+func (p *plugin) OnFailure(_ context.Context, _, _ string, _ []json.RawMessage, _ error) error {
+	return nil
+}
+
+type handler struct {
+	err       error
+	beforeErr error
+}
+
+func (h *handler) Plugins() []job.Plugin {
+	return []job.Plugin{&plugin{err: h.beforeErr}}
+}
+
+func (h *handler) Perform(_ context.Context, _, _ string, _ []json.RawMessage) (job.Result, error) {
+	return nil, h.err
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		beforeErr error
+		wantStart []string
+		wantEnd   []string
+		wantErr   bool
+	}{
+		{
+			name: "should trace the job, its plugins and perform",
+			wantStart: []string{
+				"extract:00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+				trace.SpanJob,
+				trace.SpanBeforePerform,
+				trace.SpanPerform,
+				trace.SpanAfterPerform,
+			},
+			wantEnd: []string{
+				trace.SpanBeforePerform + ":<nil>",
+				trace.SpanPerform + ":<nil>",
+				trace.SpanAfterPerform + ":<nil>",
+				trace.SpanJob + ":<nil>",
+			},
+		},
+		{
+			name: "should record the job error in the spans",
+			err:  fmt.Errorf("spanner"),
+			wantStart: []string{
+				"extract:00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+				trace.SpanJob,
+				trace.SpanBeforePerform,
+				trace.SpanPerform,
+				trace.SpanAfterPerform,
+				trace.SpanOnFailure,
+			},
+			wantEnd: []string{
+				trace.SpanBeforePerform + ":<nil>",
+				trace.SpanPerform + ":spanner",
+				trace.SpanAfterPerform + ":spanner",
+				trace.SpanOnFailure + ":<nil>",
+				trace.SpanJob + ":spanner",
+			},
+			wantErr: true,
+		},
+		{
+			name:      "should name the traced plugin in the plugin errors",
+			beforeErr: fmt.Errorf("spanner"),
+			wantStart: []string{
+				"extract:00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+				trace.SpanJob,
+				trace.SpanBeforePerform,
+				trace.SpanOnFailure,
+			},
+			wantEnd: []string{
+				trace.SpanBeforePerform + ":spanner",
+				trace.SpanOnFailure + ":<nil>",
+				trace.SpanJob + ":plugin failed: *trace_test.plugin: spanner",
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := &recorder{}
+			handlers := map[string]job.Handler{"foo": &handler{err: tt.err, beforeErr: tt.beforeErr}}
+
+			jb := &job.Job{
+				Queue: "queue1",
+				Payload: job.Payload{
+					Class: "foo",
+					Metadata: map[string]string{
+						trace.TraceParentKey: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+					},
+				},
+			}
+
+			if _, err := trace.Run(context.Background(), rec, handlers, jb); (err != nil) != tt.wantErr {
+				t.Errorf("Run() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			assert.Eq(t, len(tt.wantStart), len(rec.started))
+			for i, name := range tt.wantStart {
+				assert.Eq(t, name, rec.started[i])
+			}
+
+			assert.Eq(t, len(tt.wantEnd), len(rec.ended))
+			for i, name := range tt.wantEnd {
+				assert.Eq(t, name, rec.ended[i])
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// TraceParentKey is the carrier key of the W3C trace context.
+const TraceParentKey = "traceparent"
+
+// ErrInvalidTraceParent is returned when a traceparent value can not be parsed.
+var ErrInvalidTraceParent = errors.New("invalid traceparent")
+
+// SpanContext identifies a span as defined by the W3C trace context.
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Flags   byte
+}
+
+type spanContextKey struct{}
+
+// ParseTraceParent parses a W3C traceparent value such as
+// 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01.
+func ParseTraceParent(s string) (SpanContext, error) {
+	var sc SpanContext
+
+	parts := strings.Split(s, "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return sc, fmt.Errorf("%w: %q", ErrInvalidTraceParent, s)
+	}
+
+	if parts[0] == "00" && len(parts) != 4 {
+		return sc, fmt.Errorf("%w: %q", ErrInvalidTraceParent, s)
+	}
+
+	var flags [1]byte
+
+	fields := []struct {
+		dst []byte
+		src string
+	}{
+		{sc.TraceID[:], parts[1]},
+		{sc.SpanID[:], parts[2]},
+		{flags[:], parts[3]},
+	}
+
+	for _, f := range fields {
+		if len(f.src) != hex.EncodedLen(len(f.dst)) {
+			return sc, fmt.Errorf("%w: %q", ErrInvalidTraceParent, s)
+		}
+
+		if _, err := hex.Decode(f.dst, []byte(f.src)); err != nil {
+			return sc, fmt.Errorf("%w: %q", ErrInvalidTraceParent, s)
+		}
+	}
+
+	sc.Flags = flags[0]
+
+	if !sc.IsValid() {
+		return sc, fmt.Errorf("%w: %q", ErrInvalidTraceParent, s)
+	}
+
+	return sc, nil
+}
+
+// IsValid returns true if both the trace id and the span id are set.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// TraceParent formats the span context as a W3C traceparent value.
+func (sc SpanContext) TraceParent() string {
+	return fmt.Sprintf("00-%x-%x-%02x", sc.TraceID, sc.SpanID, sc.Flags)
+}
+
+// ContextWithSpanContext returns a copy of the context holding the span context.
+func ContextWithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, sc)
+}
+
+// SpanContextFromContext returns the span context held by the context if any.
+func SpanContextFromContext(ctx context.Context) (SpanContext, bool) {
+	sc, ok := ctx.Value(spanContextKey{}).(SpanContext)
+	return sc, ok
+}
+
+// W3C is a tracer propagating the W3C trace context through the job payloads without
+// recording the spans. It is useful to correlate the logs of the producer and the worker when
+// no tracing library is wired in.
+type W3C struct{}
+
+// Start starts a new span as a child of the span found in the context.
+func (W3C) Start(ctx context.Context, _ string, _ ...Attribute) (context.Context, Span) {
+	sc, ok := SpanContextFromContext(ctx)
+	if !ok {
+		sc = SpanContext{Flags: 1}
+		_, _ = rand.Read(sc.TraceID[:])
+	}
+
+	_, _ = rand.Read(sc.SpanID[:])
+
+	return ContextWithSpanContext(ctx, sc), nopSpan{}
+}
+
+// Inject writes the span context found in the context into the carrier.
+func (W3C) Inject(ctx context.Context, carrier map[string]string) {
+	if sc, ok := SpanContextFromContext(ctx); ok {
+		carrier[TraceParentKey] = sc.TraceParent()
+	}
+}
+
+// Extract returns a context holding the remote span context found in the carrier.
+func (W3C) Extract(ctx context.Context, carrier map[string]string) context.Context {
+	sc, err := ParseTraceParent(carrier[TraceParentKey])
+	if err != nil {
+		return ctx
+	}
+
+	return ContextWithSpanContext(ctx, sc)
+}
@@ -0,0 +1,516 @@
+package fakeredis
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gomodule/redigo/redis"
+
+	"github.com/snobb/goresq/pkg/db"
+	"github.com/snobb/goresq/pkg/db/mock"
+)
+
+// Redis is an in-memory redis supporting the subset of the commands used by goresq.
+type Redis struct {
+	mu      sync.Mutex
+	strings map[string]string
+	lists   map[string][]string
+	sets    map[string]map[string]struct{}
+	hashes  map[string]map[string]string
+	scripts map[string]Script
+}
+
+// Script emulates a lua script. The call function runs a command against the in-memory redis
+// the way redis.call does.
+type Script func(call func(commandName string, args ...interface{}) (interface{}, error), keys, args []string) (
+	interface{}, error)
+
+// New creates a new empty in-memory redis.
+func New() *Redis {
+	return &Redis{
+		strings: map[string]string{},
+		lists:   map[string][]string{},
+		sets:    map[string]map[string]struct{}{},
+		hashes:  map[string]map[string]string{},
+		scripts: map[string]Script{},
+	}
+}
+
+// RegisterScript registers the emulation of the lua script with the given source, run by EVAL
+// and EVALSHA.
+func (r *Redis) RegisterScript(src string, fn Script) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sum := sha1.Sum([]byte(src))
+	r.scripts[hex.EncodeToString(sum[:])] = fn
+}
+
+// Pool returns a pool of connections to the in-memory redis.
+func (r *Redis) Pool() db.Pooler {
+	return &mock.PoolerMock{
+		ConnFunc: func() (db.Conn, error) {
+			return r.Conn(), nil
+		},
+		CloseFunc: func() error {
+			return nil
+		},
+	}
+}
+
+// Conn returns a connection to the in-memory redis.
+func (r *Redis) Conn() db.Conn {
+	var pending []interface{}
+
+	return &mock.ConnMock{
+		CloseFunc: func() error {
+			return nil
+		},
+		DoFunc: func(commandName string, args ...interface{}) (interface{}, error) {
+			if commandName == "" {
+				replies := pending
+				pending = nil
+				return replies, nil
+			}
+
+			return r.Do(commandName, args...)
+		},
+		ErrFunc: func() error {
+			return nil
+		},
+		FlushFunc: func() error {
+			return nil
+		},
+		ReceiveFunc: func() (interface{}, error) {
+			if len(pending) == 0 {
+				return nil, fmt.Errorf("no pending replies")
+			}
+
+			reply := pending[0]
+			pending = pending[1:]
+
+			if err, ok := reply.(error); ok {
+				return nil, err
+			}
+
+			return reply, nil
+		},
+		SendFunc: func(commandName string, args ...interface{}) error {
+			reply, err := r.Do(commandName, args...)
+			if err != nil {
+				pending = append(pending, err)
+			} else {
+				pending = append(pending, reply)
+			}
+
+			return nil
+		},
+	}
+}
+
+// Seed runs the commands, failing the test at the first error.
+func (r *Redis) Seed(t testing.TB, cmds ...[]interface{}) {
+	t.Helper()
+
+	for _, cmd := range cmds {
+		if _, err := r.Do(cmd[0].(string), cmd[1:]...); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// List returns a copy of the list stored at the key.
+func (r *Redis) List(key string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]string(nil), r.lists[key]...)
+}
+
+// Get returns the string stored at the key.
+func (r *Redis) Get(key string) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	value, ok := r.strings[key]
+
+	return value, ok
+}
+
+// Members returns the sorted members of the set stored at the key.
+func (r *Redis) Members(key string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.members(key)
+}
+
+// Keys returns the sorted keys matching the pattern.
+func (r *Redis) Keys(pattern string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.keys(pattern)
+}
+
+// Do executes the command.
+func (r *Redis) Do(commandName string, args ...interface{}) (interface{}, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.do(commandName, args...)
+}
+
+func (r *Redis) do(commandName string, args ...interface{}) (interface{}, error) {
+	argv := make([]string, len(args))
+	for i, arg := range args {
+		argv[i] = toString(arg)
+	}
+
+	switch commandName {
+	case "PING":
+		return "PONG", nil
+
+	case "GET":
+		if value, ok := r.strings[argv[0]]; ok {
+			return []byte(value), nil
+		}
+
+		return nil, nil
+
+	case "SET":
+		for _, opt := range argv[2:] {
+			if strings.EqualFold(opt, "NX") && r.exists(argv[0]) {
+				return nil, nil
+			}
+		}
+
+		r.strings[argv[0]] = argv[1]
+
+		return "OK", nil
+
+	case "EXPIRE":
+		// the keys never expire, only the existence is checked.
+		if r.exists(argv[0]) {
+			return int64(1), nil
+		}
+
+		return int64(0), nil
+
+	case "DEL":
+		var n int64
+
+		for _, key := range argv {
+			if r.exists(key) {
+				n++
+			}
+
+			delete(r.strings, key)
+			delete(r.lists, key)
+			delete(r.sets, key)
+			delete(r.hashes, key)
+		}
+
+		return n, nil
+
+	case "INCR", "INCRBY":
+		by := int64(1)
+		if commandName == "INCRBY" {
+			by, _ = strconv.ParseInt(argv[1], 10, 64)
+		}
+
+		n, _ := strconv.ParseInt(r.strings[argv[0]], 10, 64)
+		n += by
+		r.strings[argv[0]] = strconv.FormatInt(n, 10)
+
+		return n, nil
+
+	case "KEYS":
+		return bulk(r.keys(argv[0])), nil
+
+	case "SCAN":
+		// the whole keyspace is returned in a single iteration.
+		pattern := "*"
+		for i := 1; i+1 < len(argv); i += 2 {
+			if strings.EqualFold(argv[i], "MATCH") {
+				pattern = argv[i+1]
+			}
+		}
+
+		return []interface{}{[]byte("0"), bulk(r.keys(pattern))}, nil
+
+	case "EVAL", "EVALSHA":
+		sha := argv[0]
+		if commandName == "EVAL" {
+			sum := sha1.Sum([]byte(argv[0]))
+			sha = hex.EncodeToString(sum[:])
+		}
+
+		fn, ok := r.scripts[sha]
+		if !ok {
+			return nil, redis.Error("NOSCRIPT No matching script")
+		}
+
+		n, err := strconv.Atoi(argv[1])
+		if err != nil || n < 0 || 2+n > len(argv) {
+			return nil, redis.Error("ERR invalid number of keys")
+		}
+
+		return fn(r.do, argv[2:2+n], argv[2+n:])
+
+	case "RPUSH":
+		r.lists[argv[0]] = append(r.lists[argv[0]], argv[1:]...)
+		return int64(len(r.lists[argv[0]])), nil
+
+	case "LPUSH":
+		for _, value := range argv[1:] {
+			r.lists[argv[0]] = append([]string{value}, r.lists[argv[0]]...)
+		}
+
+		return int64(len(r.lists[argv[0]])), nil
+
+	case "LPOP":
+		list := r.lists[argv[0]]
+		if len(list) == 0 {
+			return nil, nil
+		}
+
+		r.lists[argv[0]] = list[1:]
+
+		return []byte(list[0]), nil
+
+	case "LLEN":
+		return int64(len(r.lists[argv[0]])), nil
+
+	case "LRANGE":
+		list := r.lists[argv[0]]
+		start, stop := index(argv[1], len(list)), index(argv[2], len(list))
+
+		if start < 0 {
+			start = 0
+		}
+
+		if stop >= len(list) {
+			stop = len(list) - 1
+		}
+
+		if start > stop {
+			return []interface{}{}, nil
+		}
+
+		return bulk(list[start : stop+1]), nil
+
+	case "LINDEX":
+		list := r.lists[argv[0]]
+		i := index(argv[1], len(list))
+
+		if i < 0 || i >= len(list) {
+			return nil, nil
+		}
+
+		return []byte(list[i]), nil
+
+	case "LSET":
+		list := r.lists[argv[0]]
+		i := index(argv[1], len(list))
+
+		if i < 0 || i >= len(list) {
+			return nil, redis.Error("ERR index out of range")
+		}
+
+		list[i] = argv[2]
+
+		return "OK", nil
+
+	case "LREM":
+		count, _ := strconv.Atoi(argv[1])
+
+		var n int64
+
+		list := r.lists[argv[0]][:0]
+		for _, value := range r.lists[argv[0]] {
+			if value == argv[2] && (count == 0 || n < int64(count)) {
+				n++
+				continue
+			}
+
+			list = append(list, value)
+		}
+
+		r.lists[argv[0]] = list
+
+		return n, nil
+
+	case "SADD":
+		if r.sets[argv[0]] == nil {
+			r.sets[argv[0]] = map[string]struct{}{}
+		}
+
+		var n int64
+
+		for _, member := range argv[1:] {
+			if _, ok := r.sets[argv[0]][member]; !ok {
+				n++
+			}
+
+			r.sets[argv[0]][member] = struct{}{}
+		}
+
+		return n, nil
+
+	case "SREM":
+		var n int64
+
+		for _, member := range argv[1:] {
+			if _, ok := r.sets[argv[0]][member]; ok {
+				n++
+			}
+
+			delete(r.sets[argv[0]], member)
+		}
+
+		return n, nil
+
+	case "SMEMBERS":
+		return bulk(r.members(argv[0])), nil
+
+	case "SISMEMBER":
+		if _, ok := r.sets[argv[0]][argv[1]]; ok {
+			return int64(1), nil
+		}
+
+		return int64(0), nil
+
+	case "HSET":
+		if r.hashes[argv[0]] == nil {
+			r.hashes[argv[0]] = map[string]string{}
+		}
+
+		var n int64
+
+		for i := 1; i+1 < len(argv); i += 2 {
+			if _, ok := r.hashes[argv[0]][argv[i]]; !ok {
+				n++
+			}
+
+			r.hashes[argv[0]][argv[i]] = argv[i+1]
+		}
+
+		return n, nil
+
+	case "HDEL":
+		var n int64
+
+		for _, field := range argv[1:] {
+			if _, ok := r.hashes[argv[0]][field]; ok {
+				n++
+			}
+
+			delete(r.hashes[argv[0]], field)
+		}
+
+		return n, nil
+
+	case "HGETALL":
+		fields := make([]string, 0, len(r.hashes[argv[0]]))
+		for field := range r.hashes[argv[0]] {
+			fields = append(fields, field)
+		}
+
+		sort.Strings(fields)
+
+		values := make([]string, 0, 2*len(fields))
+		for _, field := range fields {
+			values = append(values, field, r.hashes[argv[0]][field])
+		}
+
+		return bulk(values), nil
+	}
+
+	return nil, fmt.Errorf("fakeredis: unsupported command %s", commandName)
+}
+
+func (r *Redis) exists(key string) bool {
+	_, str := r.strings[key]
+	_, list := r.lists[key]
+	_, set := r.sets[key]
+	_, hash := r.hashes[key]
+
+	return str || list || set || hash
+}
+
+func (r *Redis) members(key string) []string {
+	members := make([]string, 0, len(r.sets[key]))
+	for member := range r.sets[key] {
+		members = append(members, member)
+	}
+
+	sort.Strings(members)
+
+	return members
+}
+
+func (r *Redis) keys(pattern string) []string {
+	var keys []string
+
+	for _, m := range []map[string]struct{}{
+		keySet(r.strings), keySet(r.lists), keySet(r.sets), keySet(r.hashes),
+	} {
+		for key := range m {
+			if ok, _ := path.Match(pattern, key); ok {
+				keys = append(keys, key)
+			}
+		}
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+func keySet[V any](m map[string]V) map[string]struct{} {
+	keys := make(map[string]struct{}, len(m))
+	for key := range m {
+		keys[key] = struct{}{}
+	}
+
+	return keys
+}
+
+func index(value string, length int) int {
+	i, _ := strconv.Atoi(value)
+	if i < 0 {
+		i += length
+	}
+
+	return i
+}
+
+func bulk(values []string) []interface{} {
+	res := make([]interface{}, len(values))
+	for i, value := range values {
+		res[i] = []byte(value)
+	}
+
+	return res
+}
+
+func toString(arg interface{}) string {
+	switch v := arg.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case fmt.Stringer:
+		return v.String()
+	}
+
+	return fmt.Sprint(arg)
+}